@@ -2,35 +2,101 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/fenix1851/golang-blockchain/config"
+	"github.com/fenix1851/golang-blockchain/wallet"
 )
 
-// Блок - это структура данных, которая хранит в себе хэш предыдущего блока, хэш текущего блока и данные.
+// BlockVersion - это текущая версия формата заголовка блока.
+const BlockVersion = 1
+
+// BlockHeader - это заголовок блока. Именно его хэширует механизм консенсуса.
+type BlockHeader struct {
+	// Version - это версия формата блока.
+	Version int
+	// PrevHash - это хэш предыдущего блока.
+	PrevHash []byte
+	// MerkleRoot - это корень дерева Меркла транзакций блока.
+	MerkleRoot []byte
+	// Timestamp - это время создания блока в секундах Unix.
+	Timestamp int64
+	// Bits - это сложность блока: сколько нулевых бит должно быть в начале хэша.
+	Bits int
+	// Nonce - это число, которое подбирается при майнинге.
+	Nonce int
+	// Height - это номер блока в цепочке, у генезис-блока он равен 0.
+	Height int
+}
+
+// Блок - это структура данных, которая хранит в себе заголовок, хэш текущего блока и транзакции.
+// Signer и Signature заполняет механизм доказательства полномочий: это публичный ключ подписанта
+// и его подпись хэша заголовка. В блоках доказательства работы они пустые.
 type Block struct {
+	BlockHeader
 	Hash         []byte
 	Transactions []*Transaction
-	PrevHash     []byte
-	Nonce        int
+	Signer       []byte
+	Signature    []byte
 }
 
-// createBlock - это функция, которая создает новый блок.
-// Для этого она создает новый блок и присваивает ему данные и хэш предыдущего блока.
-func CreateBlock(txs []*Transaction, PrevHash []byte) *Block {
-	block := &Block{[]byte{}, txs, PrevHash, 0}
-	pow := NewProof(block)
-	nonce, hash := pow.Run()
-
-	block.Hash = hash[:]
-	block.Nonce = nonce
-
+// NewBlock - это функция, которая создает блок без доказательства работы.
+// Для этого она создает новый блок и присваивает ему данные, хэш предыдущего блока, высоту и сложность.
+func NewBlock(txs []*Transaction, PrevHash []byte, height, bits int) *Block {
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:   BlockVersion,
+			PrevHash:  PrevHash,
+			Timestamp: time.Now().Unix(),
+			Bits:      bits,
+			Height:    height,
+		},
+		Hash:         []byte{},
+		Transactions: txs,
+	}
+	block.MerkleRoot = block.HashTransactions()
 	return block
 }
 
-// Genesis - это функция, которая создает первый блок в блокчейне.
-// Она принимает транзакцию, которая будет записана в блок.
-func Genesis(coinbase *Transaction) *Block {
-	return CreateBlock([]*Transaction{coinbase}, []byte{})
+// RollExtraNonce - это функция, которая увеличивает extra-nonce в coinbase блока и пересчитывает корень Меркла.
+// Это дает майнеру новое пространство nonce, когда старое перебрано.
+func (b *Block) RollExtraNonce() error {
+	if len(b.Transactions) == 0 {
+		return ErrNonceSpaceExhausted
+	}
+	if _, ok := b.Transactions[0].CoinbaseHeight(); !ok {
+		return ErrNonceSpaceExhausted
+	}
+	// Меняем копию coinbase, чтобы не трогать транзакцию, на которую могут ссылаться снаружи.
+	coinbase := *b.Transactions[0]
+	coinbase.Inputes = append([]TXInput{}, coinbase.Inputes...)
+	coinbase.setExtraNonce(coinbase.extraNonce() + 1)
+	b.Transactions = append([]*Transaction{&coinbase}, b.Transactions[1:]...)
+	b.MerkleRoot = b.HashTransactions()
+	b.Nonce = 0
+	return nil
+}
+
+// GenesisBlock - это функция, которая создает первый блок блокчейна сети params.
+// Генезис-блок полностью задается параметрами сети, поэтому у всех узлов сети он одинаковый:
+// время, сложность и nonce берутся из params, а coinbase платит награду на хэш GenesisData.
+// Ключа к этому хэшу ни у кого нет, так что награду генезис-блока потратить нельзя.
+// Генезис-блок не проверяется механизмом консенсуса, узлы сверяют его хэш с params.GenesisHash.
+func GenesisBlock(params *config.ChainParams) *Block {
+	payload := bytes.Join([][]byte{ToHex(0), ToHex(0), []byte(params.GenesisData)}, []byte{})
+	coinbase := &Transaction{
+		Inputes: []TXInput{{ID: []byte{}, Out: -1, PubKey: payload}},
+		Outputs: []TXOutput{{Value: Subsidy(params, 0), PubKeyHash: wallet.PublicKeyHash([]byte(params.GenesisData))}},
+	}
+	coinbase.ID = coinbase.Hash()
+
+	block := NewBlock([]*Transaction{coinbase}, []byte{}, 0, params.Difficulty)
+	block.Timestamp = params.GenesisTime
+	block.Nonce = params.GenesisNonce
+	block.Hash = headerHash(block)
+	return block
 }
 
 // Serialize - это функция, которая сериализует блок.
@@ -42,48 +108,69 @@ func (b *Block) Serialize() []byte {
 	encoder := gob.NewEncoder(&result)
 	// Encode - это функция, которая кодирует блок в байты.
 	err := encoder.Encode(b)
-	// Если произошла ошибка, то мы останавливаем программу.
-	Handle(err)
+	// Блок состоит только из типов, которые gob умеет кодировать, поэтому ошибка здесь - это ошибка в коде.
+	handle(err)
 	// Возвращаем байты.
 	return result.Bytes()
 }
 
 // DeserializeBlock - это функция, которая десериализует блок.
 // Для этого она декодирует байты в блок.
-func Deserialize(d []byte) *Block {
+func Deserialize(d []byte) (*Block, error) {
 	// block - это блок, который мы будем декодировать.
 	var block Block
-	// decoder - это декодировщик, который будет декодировать байты в блок.
-	decoder := gob.NewDecoder(bytes.NewReader(d))
-	// Decode - это функция, которая декодирует байты в блок.
-	err := decoder.Decode(&block)
-	// Если произошла ошибка, то мы останавливаем программу.
-	Handle(err)
+	// Декодируем байты в блок. Байты могут прийти от другого узла, поэтому декодируем их через decodeGob.
+	if err := decodeGob(d, &block); err != nil {
+		return nil, err
+	}
 	// Возвращаем блок.
-	return &block
+	return &block, nil
+}
+
+// decodeGob - это функция, которая декодирует gob-данные в v. Данные могут быть испорчены или прийти
+// от чужого узла, поэтому и ошибка, и паника декодера возвращаются как ErrCorruptData.
+func decodeGob(data []byte, v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrCorruptData, r)
+		}
+	}()
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptData, err)
+	}
+	return nil
 }
 
-func Handle(err error) {
+// handle - это функция, которая останавливает программу при ошибке, возможной только из-за ошибки в коде,
+// например при gob-кодировании структуры в память. Все остальные ошибки возвращаются вызывающему.
+func handle(err error) {
 	if err != nil {
 		panic(err)
 	}
 }
 
 // HashTransactions - это функция, которая хэширует транзакции в блоке.
-// Для этого она создает слайс байтов, в который записывает хэши транзакций.
+// Результат - это корень дерева Меркла, построенного по ID транзакций.
 func (b *Block) HashTransactions() []byte {
-	// txHashes - это слайс байтов, в который мы будем записывать хэши транзакций.
+	return b.merkleTree().RootNode.Data
+}
+
+// merkleTree - это функция, которая строит дерево Меркла по ID транзакций блока.
+func (b *Block) merkleTree() *MerkleTree {
+	// txHashes - это слайс ID транзакций, которые станут листьями дерева.
 	var txHashes [][]byte
-	// txHash - это хэш транзакций.
-	var txHash [32]byte
-	// Проходимся по транзакциям в блоке.
 	for _, tx := range b.Transactions {
-		// Добавляем хэш транзакции в слайс байтов.
 		txHashes = append(txHashes, tx.ID)
 	}
-	// Склеиваем слайс байтов в один слайс байтов.
-	// Вычисляем хэш слайса байтов.
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
-	// Возвращаем хэш транзакций.
-	return txHash[:]
+	return NewMerkleTree(txHashes)
+}
+
+// MerkleProof - это функция, которая строит доказательство включения транзакции txID в блок.
+func (b *Block) MerkleProof(txID []byte) ([]MerkleProofStep, error) {
+	for i, tx := range b.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			return b.merkleTree().Proof(i), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %x", ErrTxNotInBlock, txID)
 }
@@ -1,136 +1,438 @@
 package blockchain
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math/big"
 	"os"
-	"runtime"
+	"path/filepath"
+	"sync"
 
-	"github.com/dgraph-io/badger"
+	"github.com/fenix1851/golang-blockchain/config"
+	"github.com/fenix1851/golang-blockchain/storage"
 )
 
-const (
-	dbPath      = "./tmp/blocks"
-	dbFile      = "./tmp/blocks/MANIFEST"
-	genesisData = "First Transaction from Genesis"
+// dbFile - это файл, по которому мы узнаем, что база данных блокчейна уже создана.
+const dbFile = "MANIFEST"
+
+// Ошибки открытия блокчейна и поиска в нем.
+var (
+	ErrChainExists   = errors.New("blockchain already exists")
+	ErrNoChain       = errors.New("no existing blockchain found, create one first")
+	ErrBlockNotFound = errors.New("block is not found")
+	ErrTxNotFound    = errors.New("transaction does not exist")
+	ErrTxNotInBlock  = errors.New("transaction is not in the block")
+	ErrCorruptData   = errors.New("corrupt data")
+	ErrTipChanged    = errors.New("chain tip changed while sealing the block")
 )
 
+// lastHashKey - это ключ, под которым хранится хэш последнего блока.
+var lastHashKey = []byte("lh")
+
 // Блокчейн - это структура данных, которая хранит в себе блоки.
 type BlockChain struct {
 	lastHash []byte
-	Database *badger.DB
+	// Database - это хранилище блоков, индексов и мемпула.
+	Database storage.Store
+	// Engine - это механизм консенсуса, которым блокчейн запечатывает и проверяет блоки.
+	Engine Consensus
+	// Params - это параметры сети блокчейна.
+	Params *config.ChainParams
+	// Logf - это функция, которой блокчейн и его мемпул сообщают о событиях, например о переходе на другую ветку.
+	// Если она не задана, сообщения никуда не выводятся.
+	Logf func(format string, args ...interface{})
+
+	// tipMu защищает tipChanged.
+	tipMu sync.Mutex
+	// tipChanged - это канал, который закрывается, когда меняется последний блок, см. TipChanged.
+	tipChanged chan struct{}
 }
 
 type BlockChainIterator struct {
 	currentHash []byte
-	Database    *badger.DB
-}
-
-// InitBlockChain - это функция, которая создает новый блокчейн.
-// Она принимает адрес майнера, который получит вознаграждение за создание первого блока.
-func InitBlockChain(address string) *BlockChain {
-	var lastHash []byte
-	// Если блокчейн уже существует, то мы выходим из функции.
-	if DBexists() {
-		fmt.Println("Blockchain already exists.")
-		runtime.Goexit()
-	}
-	// Если блокчейн не существует, то мы создаем его.
-	// Для этого мы создаем новую базу данных и добавляем в нее первый блок.
-	opts := badger.DefaultOptions(dbPath)
-	opts.Dir = dbPath
-	opts.ValueDir = dbPath
-	// Открываем базу данных.
-	db, err := badger.Open(opts)
-	// Если произошла ошибка, то мы выводим ее и выходим из функции.
-	Handle(err)
-	// Записываем в базу данных первый блок.
-	err = db.Update(func(txn *badger.Txn) error {
-		// Создаем первый блок.
-		// Для этого мы создаем транзакцию, которая будет храниться в первом блоке.
-		cbtx := CoinbaseTx(address, genesisData)
-		// Создаем первый блок.
-		genesis := Genesis(cbtx)
-		// Выводим сообщение о том, что генезис-блок был создан.
-		fmt.Println("Genesis proved.")
-		// Добавляем первый блок в базу данных.
-		err = txn.Set(genesis.Hash, genesis.Serialize())
-		// Если произошла ошибка, то мы выводим ее и выходим из функции.
-		Handle(err)
-		// Добавляем ключ "lh" и значение - хэш первого блока.
-		err = txn.Set([]byte("lh"), genesis.Hash)
-		// lastHash - это хэш последнего блока в блокчейне.
-		lastHash = genesis.Hash
-		// Возвращаем ошибку.
+	Database    storage.Store
+}
+
+// InitBlockChain - это функция, которая создает новый блокчейн в папке данных.
+// Блокчейн начинается с генезис-блока сети из настроек узла, см. GenesisBlock.
+// engine - это механизм консенсуса, которым запечатываются все следующие блоки.
+// Если блокчейн уже существует, возвращается ErrChainExists.
+func InitBlockChain(cfg *config.Config, engine Consensus) (*BlockChain, error) {
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := InitBlockChainWithStore(db, cfg.Params, engine)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return chain, nil
+}
+
+// InitBlockChainWithStore - это функция, которая создает новый блокчейн в хранилище db.
+// Если в хранилище уже есть блокчейн, возвращается ErrChainExists.
+func InitBlockChainWithStore(db storage.Store, params *config.ChainParams, engine Consensus) (*BlockChain, error) {
+	blockchain, err := OpenBlockChainWithStore(db, params, engine)
+	if err != nil {
+		return nil, err
+	}
+	if !blockchain.IsEmpty() {
+		return nil, ErrChainExists
+	}
+	if err := blockchain.acceptGenesis(GenesisBlock(params)); err != nil {
+		return nil, err
+	}
+	return blockchain, nil
+}
+
+// connectGenesis - это функция, которая записывает генезис-блок в пустой блокчейн одним пакетом.
+func (chain *BlockChain) connectGenesis(genesis *Block) error {
+	batch := chain.Database.NewBatch()
+	// Добавляем первый блок в хранилище.
+	if err := batch.Put(genesis.Hash, genesis.Serialize()); err != nil {
+		return err
+	}
+	// Добавляем ключ "lh" и значение - хэш первого блока.
+	if err := batch.Put(lastHashKey, genesis.Hash); err != nil {
+		return err
+	}
+	if err := batch.Put(heightKey(0), genesis.Hash); err != nil {
+		return err
+	}
+	// Сохраняем работу генезис-блока - с нее начинается суммарная работа цепочки.
+	if err := batch.Put(prefixedKey(workPrefix, genesis.Hash), BlockWork(genesis.Bits).Bytes()); err != nil {
+		return err
+	}
+	// Добавляем выходы генезис-блока в UTXOSet.
+	if err := updateUTXO(batch, genesis); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
 		return err
-	})
-	Handle(err)
+	}
+	// lastHash - это хэш последнего блока в блокчейне.
+	chain.setTip(genesis.Hash)
+	return nil
+}
 
-	blockchain := BlockChain{lastHash, db}
-	return &blockchain
+// ContinueBlockChain - это функция, которая открывает существующий блокчейн в папке данных.
+// cfg и engine должны быть теми же настройками сети и механизмом консенсуса, с которыми блокчейн был создан.
+// Если блокчейна нет, возвращается ErrNoChain.
+func ContinueBlockChain(cfg *config.Config, engine Consensus) (*BlockChain, error) {
+	if !DBexists(cfg) {
+		return nil, ErrNoChain
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := ContinueBlockChainWithStore(db, cfg.Params, engine)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return chain, nil
 }
 
-func ContinueBlockChain(address string) *BlockChain {
-	if !DBexists() {
-		fmt.Println("No existing blockchain found. Create one first.")
-		runtime.Goexit()
+// ContinueBlockChainWithStore - это функция, которая открывает блокчейн, сохраненный в хранилище db.
+// Если в хранилище нет блокчейна, возвращается ErrNoChain.
+func ContinueBlockChainWithStore(db storage.Store, params *config.ChainParams, engine Consensus) (*BlockChain, error) {
+	chain, err := OpenBlockChainWithStore(db, params, engine)
+	if err != nil {
+		return nil, err
+	}
+	if chain.IsEmpty() {
+		return nil, ErrNoChain
 	}
+	return chain, nil
+}
 
-	var lastHash []byte
-	opts := badger.DefaultOptions(dbPath)
-	opts.Dir = dbPath
-	opts.ValueDir = dbPath
-	db, err := badger.Open(opts)
-	Handle(err)
+// OpenBlockChain - это функция, которая открывает блокчейн в папке данных, создавая пустую базу данных, если ее нет.
+// Пустой блокчейн получает генезис-блок от других узлов через AcceptBlock.
+func OpenBlockChain(cfg *config.Config, engine Consensus) (*BlockChain, error) {
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := OpenBlockChainWithStore(db, cfg.Params, engine)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return chain, nil
+}
 
-	err = db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-		err = item.Value(func(val []byte) error {
-			lastHash = val
-			return nil
-		})
-		return err
-	})
-	Handle(err)
+// OpenBlockChainWithStore - это функция, которая открывает блокчейн в хранилище db.
+// Если хранилище пустое, возвращается пустой блокчейн, см. IsEmpty.
+func OpenBlockChainWithStore(db storage.Store, params *config.ChainParams, engine Consensus) (*BlockChain, error) {
+	lastHash, err := db.Get(lastHashKey)
+	if err == storage.ErrNotFound {
+		return &BlockChain{Database: db, Engine: engine, Params: params}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	chain := BlockChain{lastHash, db}
-	return &chain
+	chain := BlockChain{lastHash: lastHash, Database: db, Engine: engine, Params: params}
+
+	// Проверяем последний блок при загрузке, чтобы не работать поверх поврежденной базы.
+	tip, err := chain.GetBlock(lastHash)
+	if err == nil && tip.Height == 0 {
+		// Генезис-блок не запечатан механизмом консенсуса, его задают параметры сети.
+		err = chain.checkGenesis(&tip)
+	} else if err == nil {
+		err = CheckBlockSanity(&tip)
+		if err == nil {
+			err = engine.VerifyHeader(&chain, &tip)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("last block is invalid: %w", err)
+	}
+	if err := chain.reindexHeights(); err != nil {
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// logf - это функция, которая передает сообщение в Logf, если она задана.
+func (chain *BlockChain) logf(format string, args ...interface{}) {
+	if chain.Logf != nil {
+		chain.Logf(format, args...)
+	}
+}
+
+// IsEmpty - это функция, которая проверяет, что в блокчейне еще нет генезис-блока.
+func (chain *BlockChain) IsEmpty() bool {
+	return chain.lastHash == nil
 }
 
-func DBexists() bool {
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+// LastHash - это функция, которая возвращает хэш последнего блока или nil для пустого блокчейна.
+func (chain *BlockChain) LastHash() []byte {
+	return chain.lastHash
+}
+
+// DBexists - это функция, которая проверяет, создана ли база данных блокчейна в папке данных cfg.
+func DBexists(cfg *config.Config) bool {
+	if _, err := os.Stat(filepath.Join(cfg.BlocksDir(), dbFile)); os.IsNotExist(err) {
 		return false
 	}
 	return true
 }
 
+// openDB - это функция, которая открывает базу данных блокчейна в папке данных cfg.
+func openDB(cfg *config.Config) (storage.Store, error) {
+	return storage.OpenBadger(cfg.BlocksDir())
+}
+
 // AddBlock - это функция, которая добавляет новый блок в блокчейн.
 // Для этого она получает последний блок в блокчейне и создает новый блок.
-// После этого она добавляет новый блок в блокчейн.
-func (chain *BlockChain) AddBlock(txs []*Transaction) {
-	var lastHash []byte
-	err := chain.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-		err = item.Value(func(val []byte) error {
-			lastHash = val
-			return nil
-		})
+// После этого она добавляет новый блок в блокчейн и в той же транзакции базы данных обновляет UTXOSet.
+func (chain *BlockChain) AddBlock(txs []*Transaction) (*Block, error) {
+	return chain.AddBlockContext(context.Background(), txs)
+}
+
+// AddBlockContext - это функция, которая запечатывает блок из txs механизмом консенсуса и добавляет его в блокчейн.
+// Запечатывание, например майнинг, можно прервать через ctx. Оно прерывается и само, если за это время
+// последний блок сменился, например пришел конкурирующий блок. Тогда возвращается ErrTipChanged.
+func (chain *BlockChain) AddBlockContext(ctx context.Context, txs []*Transaction) (*Block, error) {
+	// Проверяем транзакции до майнинга, чтобы не тратить работу на заведомо плохой блок.
+	if _, err := chain.ValidateTransactions(txs); err != nil {
+		return nil, err
+	}
+
+	// Блок, запечатанный поверх сменившегося последнего блока, уже не нужен.
+	tipChanged := chain.TipChanged()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-tipChanged:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Получаем последний блок, чтобы узнать высоту нового блока.
+	lastBlock, err := chain.GetBlock(chain.lastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	newBlock := NewBlock(txs, chain.lastHash, lastBlock.Height+1, 0)
+	// Время блока должно быть больше медианного времени последних блоков, даже если часы узла отстают.
+	if newBlock.Timestamp, err = chain.nextTimestamp(&lastBlock); err != nil {
+		return nil, err
+	}
+	if err := chain.sealBlock(ctx, newBlock); err != nil {
+		select {
+		case <-tipChanged:
+			return nil, fmt.Errorf("%w: %v", ErrTipChanged, err)
+		default:
+			return nil, err
+		}
+	}
+
+	// Намайненный блок проходит ту же проверку, что и блок, полученный от других узлов.
+	if err := chain.AcceptBlock(newBlock); err != nil {
+		return nil, err
+	}
+	return newBlock, nil
+}
+
+// MineBlock - это функция, которая майнит блок из транзакций txs.
+// В начало блока добавляется coinbase, которая платит на адрес miner награду за блок и комиссии транзакций.
+func (chain *BlockChain) MineBlock(miner string, txs []*Transaction) (*Block, error) {
+	return chain.MineBlockContext(context.Background(), miner, txs)
+}
+
+// MineBlockContext - это функция, которая делает то же, что MineBlock, но с возможностью отмены через ctx.
+func (chain *BlockChain) MineBlockContext(ctx context.Context, miner string, txs []*Transaction) (*Block, error) {
+	fees, err := chain.ValidateTransactions(txs)
+	if err != nil {
+		return nil, err
+	}
+	bestHeight, err := chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	height := bestHeight + 1
+	coinbase, err := NewCoinbaseTx(chain.Params, miner, "", chain.Subsidy(height)+fees, height, 0)
+	if err != nil {
+		return nil, err
+	}
+	return chain.AddBlockContext(ctx, append([]*Transaction{coinbase}, txs...))
+}
+
+// AcceptBlock - это функция, которая проверяет блок и сохраняет его.
+// Блок, продолжающий последний блок, сразу становится последним.
+// Блок на другой ветке сохраняется, и если у его ветки больше суммарной работы,
+// блокчейн переключается на нее.
+func (chain *BlockChain) AcceptBlock(block *Block) error {
+	if _, err := chain.GetBlock(block.Hash); err == nil {
+		return nil
+	}
+	if chain.IsEmpty() {
+		return chain.acceptGenesis(block)
+	}
+	if err := chain.checkBlockHeader(block); err != nil {
 		return err
-	})
-	Handle(err)
+	}
+
+	parentWork, err := chain.Work(block.PrevHash)
+	if err != nil {
+		return err
+	}
+	work := new(big.Int).Add(parentWork, BlockWork(block.Bits))
 
-	newBlock := CreateBlock(txs, lastHash)
+	if bytes.Equal(block.PrevHash, chain.lastHash) {
+		if err := chain.validateBlockTransactions(block); err != nil {
+			return err
+		}
+		if err := chain.storeBlock(block, work); err != nil {
+			return err
+		}
+		return chain.connectBlock(block)
+	}
 
-	err = chain.Database.Update(func(txn *badger.Txn) error {
-		err := txn.Set(newBlock.Hash, newBlock.Serialize())
-		Handle(err)
-		err = txn.Set([]byte("lh"), newBlock.Hash)
-		chain.lastHash = newBlock.Hash
+	// Блок боковой ветки: транзакции проверяются только при переходе на эту ветку.
+	if err := chain.storeBlock(block, work); err != nil {
+		return err
+	}
+	tipWork, err := chain.Work(chain.lastHash)
+	if err != nil {
 		return err
-	})
-	Handle(err)
+	}
+	if work.Cmp(tipWork) > 0 {
+		return chain.reorganize(block)
+	}
+	return nil
+}
+
+// GetBestHeight - это функция, которая возвращает высоту последнего блока.
+// У пустого блокчейна высота равна -1.
+func (chain *BlockChain) GetBestHeight() (int, error) {
+	if chain.IsEmpty() {
+		return -1, nil
+	}
+	lastBlock, err := chain.GetBlock(chain.lastHash)
+	if err != nil {
+		return 0, err
+	}
+	return lastBlock.Height, nil
+}
+
+// acceptGenesis - это функция, которая проверяет генезис-блок, полученный от другого узла, и делает его первым блоком.
+func (chain *BlockChain) acceptGenesis(block *Block) error {
+	if block.Height != 0 || len(block.PrevHash) != 0 {
+		return fmt.Errorf("%w: %x", ErrOrphanBlock, block.PrevHash)
+	}
+	if err := chain.checkGenesis(block); err != nil {
+		return err
+	}
+	return chain.connectGenesis(block)
+}
+
+// CheckSeal - это функция, которая проверяет печать блока механизмом консенсуса блокчейна.
+// Генезис-блок задан параметрами сети и не запечатан, поэтому для него проверяется, что он совпадает с генезис-блоком сети.
+func (chain *BlockChain) CheckSeal(block *Block) error {
+	if block.Height == 0 {
+		return chain.checkGenesis(block)
+	}
+	return chain.Engine.VerifyHeader(chain, block)
+}
+
+// checkGenesis - это функция, которая проверяет, что block - это генезис-блок сети блокчейна.
+// Хэш покрывает заголовок, а корень Меркла в заголовке - транзакции, поэтому подменить генезис-блок нельзя.
+func (chain *BlockChain) checkGenesis(block *Block) error {
+	if err := CheckBlockSanity(block); err != nil {
+		return err
+	}
+	if !bytes.Equal(block.Hash, headerHash(block)) {
+		return ErrBadBlockHash
+	}
+	expected := GenesisBlock(chain.Params)
+	if !bytes.Equal(block.Hash, expected.Hash) {
+		return fmt.Errorf("%w: got %x, want %x", ErrBadGenesis, block.Hash, expected.Hash)
+	}
+	if chain.Params.GenesisHash != "" && hex.EncodeToString(expected.Hash) != chain.Params.GenesisHash {
+		return fmt.Errorf("%w: parameters of %s give %x, want %s",
+			ErrBadGenesis, chain.Params.Name, expected.Hash, chain.Params.GenesisHash)
+	}
+	return nil
+}
+
+// HasBlock - это функция, которая проверяет, сохранен ли блок с хэшем blockHash.
+func (chain *BlockChain) HasBlock(blockHash []byte) bool {
+	_, err := readBlock(chain.Database, blockHash)
+	return err == nil
+}
+
+// GetBlock - это функция, которая достает блок из базы данных по его хэшу.
+func (chain *BlockChain) GetBlock(blockHash []byte) (Block, error) {
+	block, err := readBlock(chain.Database, blockHash)
+	if err != nil {
+		return Block{}, err
+	}
+	return *block, nil
+}
+
+// readBlock - это функция, которая читает блок из хранилища db по его хэшу.
+func readBlock(db storage.Store, blockHash []byte) (*Block, error) {
+	data, err := db.Get(blockHash)
+	if err == storage.ErrNotFound {
+		return nil, fmt.Errorf("%w: %x", ErrBlockNotFound, blockHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Deserialize(data)
 }
 
 func (chain *BlockChain) Iterator() *BlockChainIterator {
@@ -138,149 +440,125 @@ func (chain *BlockChain) Iterator() *BlockChainIterator {
 	return iter
 }
 
-func (iter *BlockChainIterator) Next() *Block {
-	var block *Block
-	err := iter.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(iter.currentHash)
-		Handle(err)
-		var encodedBlock []byte
-		err = item.Value(func(val []byte) error {
-			encodedBlock = val
-			return nil
-		})
-		Handle(err)
-		block = Deserialize(encodedBlock)
-		return err
-	})
-	Handle(err)
+// Next - это функция, которая возвращает очередной блок, двигаясь от последнего блока к генезис-блоку.
+func (iter *BlockChainIterator) Next() (*Block, error) {
+	block, err := readBlock(iter.Database, iter.currentHash)
+	if err != nil {
+		return nil, err
+	}
 	iter.currentHash = block.PrevHash
-	return block
+	return block, nil
 }
 
-// FindUnspentTransactions - это функция, которая находит все непотраченные транзакции.
-// Unspent transactions - это транзакции, которые еще не были потрачены.
-// Это значит, что они находятся в блокчейне, но еще не были использованы.
-// т.е. они находятся в выходах транзакций.
-// но не находятся во входах транзакций.
-
-func (chain *BlockChain) FindUnspentTransactions(address string) []Transaction {
-	// Создаем слайс, который будет хранить все непотраченные транзакции.
-	var unspentTXs []Transaction
-	// Создаем слайс, который будет хранить все транзакции, которые были потрачены.
+// FindUTXO - это функция, которая находит все непотраченные выходы во всем блокчейне.
+// Unspent outputs - это выходы транзакций, которые еще не были потрачены.
+// Это значит, что они находятся в выходах транзакций,
+// но на них не ссылается ни один вход.
+// Функция обходит весь блокчейн, поэтому используется только для построения UTXOSet.
+func (chain *BlockChain) FindUTXO() (map[string]TXOutputs, error) {
+	// UTXO - это непотраченные выходы, сгруппированные по ID транзакции.
+	UTXO := make(map[string]TXOutputs)
+	// spentTXOs - это потраченные выходы, сгруппированные по ID транзакции.
 	spentTXOs := make(map[string][]int)
-	// Создаем итератор для блокчейна.
-	bcIterator := chain.Iterator()
-	// Перебираем все блоки в блокчейне.
+	// Блоки обходятся от последнего к первому, поэтому вход всегда встречается раньше выхода, который он тратит.
+	iter := chain.Iterator()
+
 	for {
-		// Получаем текущий блок.
-		block := bcIterator.Next()
-		// Перебираем все транзакции в блоке.
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+
 		for _, tx := range block.Transactions {
-			// Получаем ID транзакции.
 			txID := hex.EncodeToString(tx.ID)
-			// Перебираем все выходы транзакции.
+
 		Outputs:
 			for outIdx, out := range tx.Outputs {
-				// Если в слайсе spentTXOs есть транзакция с ID, который мы получили выше,
-				// то мы перебираем все ее выходы.
-				if spentTXOs[txID] != nil {
-					for _, spentOut := range spentTXOs[txID] {
-						// Если индекс выхода транзакции совпадает с индексом выхода транзакции,
-						// которая была потрачена, то мы переходим к следующей транзакции.
-						if spentOut == outIdx {
-							continue Outputs
-						}
+				for _, spentOut := range spentTXOs[txID] {
+					if spentOut == outIdx {
+						continue Outputs
 					}
 				}
-				// Если выход транзакции не был потрачен, то мы добавляем его в слайс непотраченных транзакций.
-				if out.CanBeUnlocked(address) {
-					unspentTXs = append(unspentTXs, *tx)
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = newTXOutputs(tx.IsCoinbase(), block.Height)
 				}
+				outs.Outputs[outIdx] = out
+				UTXO[txID] = outs
 			}
-			// Если транзакция не является кухней, то мы переходим к следующей транзакции.
+
 			if !tx.IsCoinbase() {
-				// Перебираем все входы транзакции.
 				for _, in := range tx.Inputes {
-					// Если вход транзакции может быть разблокирован с помощью адреса,
-					// то мы добавляем его в слайс потраченных транзакций.
-					if in.CanUnlock(address) {
-						// Получаем ID транзакции, которая была потрачена.
-						// И добавляем ее в слайс потраченных транзакций.
-						// Также мы добавляем индекс выхода транзакции, который был потрачен.
-						// Это нужно для того, чтобы мы могли отслеживать, какие выходы транзакций были потрачены.
-						// Так как одна транзакция может иметь несколько выходов.
-						// И мы должны отслеживать, какие из них были потрачены.
-						// И какие еще остались непотраченными.
-						inTxID := hex.EncodeToString(in.ID)
-						spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
-					}
+					inTxID := hex.EncodeToString(in.ID)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
 				}
 			}
 		}
-		// Если текущий блок является первым блоком в блокчейне, то мы выходим из цикла.
+
 		if len(block.PrevHash) == 0 {
 			break
 		}
 	}
-	// Возвращаем слайс непотраченных транзакций.
-	return unspentTXs
-}
-
-func (chain *BlockChain) FindUTXO(address string) []TXOutput {
-	// Получаем все непотраченные транзакции.
-	var UTXOs []TXOutput
-	unspentTransactions := chain.FindUnspentTransactions(address)
-	// Перебираем все непотраченные транзакции.
-	for _, tx := range unspentTransactions {
-		// Перебираем все выходы транзакции.
-		for _, out := range tx.Outputs {
-			// Если выход транзакции может быть разблокирован с помощью адреса,
-			// то мы добавляем его в слайс UTXOs.
-			if out.CanBeUnlocked(address) {
-				UTXOs = append(UTXOs, out)
+	return UTXO, nil
+}
+
+// FindTransaction - это функция, которая ищет транзакцию в блокчейне по ID.
+func (chain *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
+	iter := chain.Iterator()
+
+	for {
+		block, err := iter.Next()
+		if err != nil {
+			return Transaction{}, err
+		}
+
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, ID) {
+				return *tx, nil
 			}
 		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
 	}
-	// Возвращаем слайс UTXOs.
-	return UTXOs
+
+	return Transaction{}, fmt.Errorf("%w: %x", ErrTxNotFound, ID)
 }
 
-// FindSpendableOutputs - это функция, которая находит все непотраченные выходы транзакций.
-// Unspent outputs - это выходы транзакций, которые еще не были потрачены.
-// Это значит, что они находятся в блокчейне, но еще не были использованы.
-// т.е. они находятся в выходах транзакций.
-// но не находятся во входах транзакций.
-// Но в отличие от FindUnspentTransactions, эта функция возвращает не транзакции,
-// а выходы транзакций, которые еще не были потрачены.
-// Это нужно для того, чтобы мы могли создать новую транзакцию, которая будет потратить эти выходы транзакций.
-// Так как в транзакции должны быть указаны входы и выходы.
-// И входы должны быть указаны с помощью ID транзакции и индекса выхода транзакции.
-// А выходы должны быть указаны с помощью адреса и суммы.
-
-func (chain *BlockChain) FindSpendableOutputs(address string, amount int) (int, map[string][]int) {
-	// Создаем слайс, который будет хранить все непотраченные выходы транзакций.
-	unspentOutputs := make(map[string][]int)
-	// Создаем переменную, которая будет хранить сумму всех непотраченных выходов транзакций.
-	unspentTXs := chain.FindUnspentTransactions(address)
-	accumulated := 0
-	// Перебираем все непотраченные транзакции.
-Work:
-	for _, tx := range unspentTXs {
-		// Получаем ID транзакции.
-		txID := hex.EncodeToString(tx.ID)
-		// Перебираем все выходы транзакции.
-		for outIdx, out := range tx.Outputs {
-			// Если выход транзакции может быть разблокирован с помощью адреса,
-			// то мы добавляем его в слайс непотраченных выходов транзакций.
-			if out.CanBeUnlocked(address) && accumulated < amount {
-				accumulated += out.Value
-				unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
-				if accumulated >= amount {
-					break Work
-				}
-			}
+// SignTransaction - это функция, которая находит в UTXOSet выходы, которые тратят входы, и подписывает транзакцию.
+// Обходить блокчейн не нужно: для подписи хватает хэша публичного ключа, который хранит UTXOSet.
+func (chain *BlockChain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) error {
+	prevOuts, err := chain.spentOutputs(tx)
+	if err != nil {
+		return err
+	}
+	return tx.SignOutputs(privKey, prevOuts)
+}
+
+// VerifyTransaction - это функция, которая проверяет подписи транзакции.
+// Транзакция, ссылающаяся на потраченные или несуществующие выходы, считается недействительной.
+func (chain *BlockChain) VerifyTransaction(tx *Transaction) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+	prevOuts, err := chain.spentOutputs(tx)
+	return err == nil && tx.VerifyOutputs(prevOuts)
+}
+
+// spentOutputs - это функция, которая находит в UTXOSet выходы, которые тратят входы транзакции.
+func (chain *BlockChain) spentOutputs(tx *Transaction) ([]TXOutput, error) {
+	UTXOSet := UTXOSet{Blockchain: chain}
+	prevOuts := make([]TXOutput, 0, len(tx.Inputes))
+	for _, in := range tx.Inputes {
+		out, found, err := UTXOSet.FindOutput(in.ID, in.Out)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %x:%d", ErrMissingInput, in.ID, in.Out)
 		}
+		prevOuts = append(prevOuts, out)
 	}
-	// Возвращаем сумму всех непотраченных выходов транзакций и слайс непотраченных выходов транзакций.
-	return accumulated, unspentOutputs
+	return prevOuts, nil
 }
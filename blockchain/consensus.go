@@ -0,0 +1,135 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Consensus - это механизм консенсуса: правила, по которым блок запечатывается и проверяется.
+// Блокчейн не знает, как устроен механизм, и только вызывает его методы,
+// поэтому доказательство работы можно заменить, не меняя остальной код пакета.
+type Consensus interface {
+	// Prepare - это функция, которая заполняет поля заголовка, которые задает механизм, например сложность.
+	Prepare(chain *BlockChain, block *Block) error
+	// Seal - это функция, которая запечатывает подготовленный блок: записывает в него nonce и хэш.
+	// Запечатывание можно прервать через ctx.
+	Seal(ctx context.Context, chain *BlockChain, block *Block) error
+	// VerifyHeader - это функция, которая проверяет, что заголовок блока запечатан по правилам механизма.
+	VerifyHeader(chain *BlockChain, block *Block) error
+	// VerifySeal - это функция, которая проверяет печать блока, родителя которого у узла еще нет.
+	// Она отсекает блоки-сироты, которые ничего не стоило создать.
+	VerifySeal(chain *BlockChain, block *Block) error
+}
+
+// PoWEngine - это механизм консенсуса доказательства работы. Он используется по умолчанию.
+type PoWEngine struct {
+	// Miner - это майнер, которым запечатываются блоки.
+	Miner *Miner
+}
+
+// NewPoWEngine - это функция, которая создает механизм доказательства работы с майнером NewMiner.
+func NewPoWEngine() *PoWEngine {
+	return &PoWEngine{Miner: NewMiner()}
+}
+
+// Prepare - это функция, которая записывает в блок сложность, ожидаемую для его высоты.
+// Сложность генезис-блока задается параметрами сети.
+func (e *PoWEngine) Prepare(chain *BlockChain, block *Block) error {
+	if block.Height == 0 {
+		block.Bits = chain.Params.Difficulty
+		return nil
+	}
+	prev, err := chain.GetBlock(block.PrevHash)
+	if err != nil {
+		return fmt.Errorf("%w: %x", ErrOrphanBlock, block.PrevHash)
+	}
+	block.Bits, err = chain.NextBits(&prev)
+	return err
+}
+
+// Seal - это функция, которая майнит блок.
+func (e *PoWEngine) Seal(ctx context.Context, chain *BlockChain, block *Block) error {
+	return e.Miner.Mine(ctx, block)
+}
+
+// VerifyHeader - это функция, которая проверяет хэш блока и доказательство работы.
+func (e *PoWEngine) VerifyHeader(chain *BlockChain, block *Block) error {
+	if !bytes.Equal(block.Hash, headerHash(block)) {
+		return ErrBadBlockHash
+	}
+	if !chain.ValidateProof(block) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifySeal - это функция, которая проверяет хэш блока и доказательство работы по его собственной сложности.
+// Сложность не может быть ниже той, до которой она успела бы упасть от сложности основной цепочки, см. MinOrphanBits.
+func (e *PoWEngine) VerifySeal(chain *BlockChain, block *Block) error {
+	if !bytes.Equal(block.Hash, headerHash(block)) {
+		return ErrBadBlockHash
+	}
+	min, err := chain.MinOrphanBits(block.Height)
+	if err != nil {
+		return err
+	}
+	if block.Bits < min {
+		return fmt.Errorf("%w: bits %d, at least %d", ErrInvalidProof, block.Bits, min)
+	}
+	if !NewProof(block).Validate() {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// InstantSealEngine - это механизм консенсуса, который запечатывает блок сразу, без перебора nonce.
+// Он нужен для тестов: блоки создаются мгновенно, а проверка заголовка по-прежнему ловит подмену.
+// У всех блоков нулевая сложность, поэтому при выборе ветки побеждает самая длинная.
+type InstantSealEngine struct{}
+
+// Prepare - это функция, которая обнуляет сложность блока.
+func (InstantSealEngine) Prepare(chain *BlockChain, block *Block) error {
+	block.Bits = 0
+	return nil
+}
+
+// Seal - это функция, которая записывает в блок хэш заголовка.
+func (InstantSealEngine) Seal(ctx context.Context, chain *BlockChain, block *Block) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	block.Hash = headerHash(block)
+	return nil
+}
+
+// VerifyHeader - это функция, которая проверяет, что у блока нулевая сложность и хэш совпадает с заголовком.
+func (InstantSealEngine) VerifyHeader(chain *BlockChain, block *Block) error {
+	if block.Bits != 0 {
+		return fmt.Errorf("%w: instant seal block has bits %d", ErrInvalidProof, block.Bits)
+	}
+	if !bytes.Equal(block.Hash, headerHash(block)) {
+		return ErrBadBlockHash
+	}
+	return nil
+}
+
+// VerifySeal - это функция, которая проверяет заголовок так же, как VerifyHeader: родитель для этого не нужен.
+func (e InstantSealEngine) VerifySeal(chain *BlockChain, block *Block) error {
+	return e.VerifyHeader(chain, block)
+}
+
+// headerHash - это функция, которая считает хэш заголовка блока с его текущим nonce.
+func headerHash(block *Block) []byte {
+	hash := sha256.Sum256(NewProof(block).InitData(block.Nonce))
+	return hash[:]
+}
+
+// sealBlock - это функция, которая готовит и запечатывает блок механизмом консенсуса блокчейна.
+func (chain *BlockChain) sealBlock(ctx context.Context, block *Block) error {
+	if err := chain.Engine.Prepare(chain, block); err != nil {
+		return err
+	}
+	return chain.Engine.Seal(ctx, chain, block)
+}
@@ -0,0 +1,167 @@
+package blockchain
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// RetargetInterval - это через сколько блоков пересчитывается сложность.
+	RetargetInterval = 10
+	// TargetBlockTime - это желаемое время между блоками в секундах.
+	TargetBlockTime = 10
+	// maxRetargetFactor - это во сколько раз сложность может измениться за один пересчет.
+	maxRetargetFactor = 4
+	// maxRetargetBits - это на сколько бит сложность может упасть за один пересчет: log2(maxRetargetFactor).
+	maxRetargetBits = 2
+	// MinDifficulty и MaxDifficulty - это допустимые границы сложности в битах.
+	MinDifficulty = 1
+	MaxDifficulty = 255
+	// MedianTimeSpan - это по скольким последним блокам считается медианное время.
+	MedianTimeSpan = 11
+	// MaxFutureBlockTime - это на сколько секунд время блока может опережать часы узла.
+	MaxFutureBlockTime = 2 * 60 * 60
+)
+
+// CalculateBits - это функция, которая считает новую сложность по времени, за которое были найдены блоки.
+// bits - это сложность последнего блока, actual - сколько секунд на самом деле заняли blocks блоков.
+// Сложность в битах: каждый лишний бит вдвое уменьшает целевое значение,
+// поэтому сложность меняется на двоичный логарифм отношения желаемого и реального времени.
+func CalculateBits(bits int, actual int64, blocks int) int {
+	expected := int64(TargetBlockTime * blocks)
+
+	// Ограничиваем изменение, чтобы одно окно с аномальными метками времени не сломало сложность.
+	if actual < expected/maxRetargetFactor {
+		actual = expected / maxRetargetFactor
+	}
+	if actual > expected*maxRetargetFactor {
+		actual = expected * maxRetargetFactor
+	}
+	if actual < 1 {
+		actual = 1
+	}
+
+	bits += int(math.Round(math.Log2(float64(expected) / float64(actual))))
+
+	if bits < MinDifficulty {
+		bits = MinDifficulty
+	}
+	if bits > MaxDifficulty {
+		bits = MaxDifficulty
+	}
+	return bits
+}
+
+// NextBits - это функция, которая возвращает сложность, которую должен иметь блок после prev.
+// Сложность меняется только на высотах, кратных RetargetInterval,
+// в остальных блоках она такая же, как у предыдущего. В сети без пересчета сложность не меняется никогда.
+func (chain *BlockChain) NextBits(prev *Block) (int, error) {
+	height := prev.Height + 1
+	if chain.Params.NoRetargeting || height%RetargetInterval != 0 {
+		return prev.Bits, nil
+	}
+
+	// Ищем первый блок окна: от него до prev прошло RetargetInterval-1 интервалов.
+	first := prev
+	for i := 0; i < RetargetInterval-1; i++ {
+		block, err := chain.GetBlock(first.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+		first = &block
+	}
+
+	return CalculateBits(prev.Bits, prev.Timestamp-first.Timestamp, RetargetInterval-1), nil
+}
+
+// ValidateProof - это функция, которая проверяет, что блок имеет сложность, ожидаемую для его высоты,
+// и что его хэш удовлетворяет этой сложности.
+func (chain *BlockChain) ValidateProof(block *Block) bool {
+	expected := chain.Params.Difficulty
+	if block.Height > 0 {
+		prev, err := chain.GetBlock(block.PrevHash)
+		if err != nil {
+			return false
+		}
+		expected, err = chain.NextBits(&prev)
+		if err != nil {
+			return false
+		}
+	}
+
+	return NewProof(block).ValidateBits(expected)
+}
+
+// MinOrphanBits - это функция, которая возвращает наименьшую сложность, которую может иметь блок на высоте height,
+// родителя которого у узла нет. Отсчет идет от блока основной цепочки на этой высоте или от последнего блока,
+// а в пустом блокчейне - от сложности генезис-блока. За каждый пересчет между ними сложность падает
+// не больше чем на maxRetargetBits, и еще один пересчет оставлен на случай, если ветка отделилась раньше.
+func (chain *BlockChain) MinOrphanBits(height int) (int, error) {
+	ref, bits := 0, chain.Params.Difficulty
+	if !chain.IsEmpty() {
+		best, err := chain.GetBestHeight()
+		if err != nil {
+			return 0, err
+		}
+		ref = height
+		if ref > best {
+			ref = best
+		}
+		hash, err := chain.MainChainHash(ref)
+		if err != nil {
+			return 0, err
+		}
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return 0, err
+		}
+		bits = block.Bits
+	}
+	if chain.Params.NoRetargeting {
+		return bits, nil
+	}
+
+	retargets := height/RetargetInterval - ref/RetargetInterval + 1
+	bits -= retargets * maxRetargetBits
+	if bits < MinDifficulty {
+		bits = MinDifficulty
+	}
+	return bits, nil
+}
+
+// MedianTimePast - это функция, которая возвращает медиану времени блока prev и MedianTimeSpan-1 блоков перед ним.
+// Время следующего блока должно быть больше медианы: так один майнер не может откатить время цепочки назад,
+// а значит и занизить время окна пересчета сложности.
+func (chain *BlockChain) MedianTimePast(prev *Block) (int64, error) {
+	times := make([]int64, 0, MedianTimeSpan)
+	block := prev
+	for {
+		times = append(times, block.Timestamp)
+		if len(times) == MedianTimeSpan || block.Height == 0 {
+			break
+		}
+		parent, err := chain.GetBlock(block.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+		block = &parent
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2], nil
+}
+
+// nextTimestamp - это функция, которая возвращает время для нового блока после prev:
+// текущее время, но не меньше медианного времени плюс одна секунда.
+func (chain *BlockChain) nextTimestamp(prev *Block) (int64, error) {
+	median, err := chain.MedianTimePast(prev)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().Unix()
+	if now <= median {
+		now = median + 1
+	}
+	return now, nil
+}
@@ -0,0 +1,136 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/fenix1851/golang-blockchain/storage"
+)
+
+// locatorDenseBlocks - это сколько последних блоков локатор перечисляет подряд, прежде чем начать удваивать шаг.
+const locatorDenseBlocks = 10
+
+// heightPrefix - это префикс ключей индекса основной цепочки: по высоте хранится хэш блока основной цепочки.
+var heightPrefix = []byte("height-")
+
+// heightKey - это функция, которая возвращает ключ индекса основной цепочки для высоты height.
+func heightKey(height int) []byte {
+	return prefixedKey(heightPrefix, ToHex(int64(height)))
+}
+
+// MainChainHash - это функция, которая возвращает хэш блока основной цепочки на высоте height.
+// Если на этой высоте блока нет, возвращается ErrBlockNotFound.
+func (chain *BlockChain) MainChainHash(height int) ([]byte, error) {
+	hash, err := chain.Database.Get(heightKey(height))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: height %d", ErrBlockNotFound, height)
+	}
+	return hash, err
+}
+
+// inMainChain - это функция, которая проверяет, что блок hash лежит в основной цепочке, и возвращает его высоту.
+func (chain *BlockChain) inMainChain(hash []byte) (int, bool) {
+	block, err := chain.GetBlock(hash)
+	if err != nil {
+		return 0, false
+	}
+	main, err := chain.MainChainHash(block.Height)
+	return block.Height, err == nil && bytes.Equal(main, hash)
+}
+
+// reindexHeights - это функция, которая строит индекс основной цепочки, если его нет.
+// Он нужен базам данных, созданным до появления индекса.
+func (chain *BlockChain) reindexHeights() error {
+	tip, err := chain.GetBlock(chain.lastHash)
+	if err != nil {
+		return err
+	}
+	if hash, err := chain.MainChainHash(tip.Height); err == nil && bytes.Equal(hash, tip.Hash) {
+		return nil
+	}
+
+	batch := chain.Database.NewBatch()
+	pending := 0
+	iter := chain.Iterator()
+	for {
+		block, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(heightKey(block.Height), block.Hash); err != nil {
+			return err
+		}
+		if pending++; pending == deleteBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			pending = 0
+		}
+		if len(block.PrevHash) == 0 {
+			return batch.Write()
+		}
+	}
+}
+
+// BlockLocator - это функция, которая возвращает хэши блоков основной цепочки, по которым другой узел
+// найдет наш последний общий с ним блок. Сначала идут последние блоки подряд, затем с удваивающимся шагом,
+// последним всегда идет генезис-блок. У пустого блокчейна локатор пустой.
+func (chain *BlockChain) BlockLocator() ([][]byte, error) {
+	var locator [][]byte
+	if chain.IsEmpty() {
+		return locator, nil
+	}
+	height, err := chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	step := 1
+	for ; height > 0; height -= step {
+		hash, err := chain.MainChainHash(height)
+		if err != nil {
+			return nil, err
+		}
+		locator = append(locator, hash)
+		if len(locator) >= locatorDenseBlocks {
+			step *= 2
+		}
+	}
+	genesis, err := chain.MainChainHash(0)
+	if err != nil {
+		return nil, err
+	}
+	return append(locator, genesis), nil
+}
+
+// BlockHashesAfter - это функция, которая возвращает до max хэшей блоков основной цепочки,
+// идущих после первого блока локатора, который есть в основной цепочке, от старых к новым.
+// Если общего блока нет, хэши перечисляются с генезис-блока.
+func (chain *BlockChain) BlockHashesAfter(locator [][]byte, max int) ([][]byte, error) {
+	if chain.IsEmpty() || max <= 0 {
+		return nil, nil
+	}
+	best, err := chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+	for _, hash := range locator {
+		if height, ok := chain.inMainChain(hash); ok {
+			start = height + 1
+			break
+		}
+	}
+
+	var hashes [][]byte
+	for height := start; height <= best && len(hashes) < max; height++ {
+		hash, err := chain.MainChainHash(height)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
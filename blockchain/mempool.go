@@ -0,0 +1,318 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxMempoolSize - это максимальный суммарный размер транзакций в мемпуле в байтах.
+	MaxMempoolSize = 32 << 20
+	// MaxMempoolAge - это сколько транзакция может ждать в мемпуле, прежде чем будет удалена.
+	MaxMempoolAge = 72 * time.Hour
+	// MaxBlockTxSize - это максимальный суммарный размер транзакций в шаблоне блока в байтах.
+	MaxBlockTxSize = 1 << 20
+)
+
+// mempoolPrefix - это префикс ключей, под которыми мемпул хранится в базе данных.
+// Так транзакции, отправленные разными командами, попадают в один блок.
+var mempoolPrefix = []byte("mempool-")
+
+// Ошибки мемпула.
+var (
+	ErrMempoolExists   = errors.New("transaction is already in the mempool")
+	ErrMempoolConflict = errors.New("transaction spends an output already spent in the mempool")
+	ErrMempoolFull     = errors.New("mempool is full and fee rate is too low")
+)
+
+// MempoolEntry - это транзакция в мемпуле вместе с ее комиссией, размером и временем добавления.
+type MempoolEntry struct {
+	Tx    *Transaction
+	Fee   int
+	Size  int
+	Added int64
+}
+
+// feeRateLess - это функция, которая сравнивает комиссию за байт двух записей без деления.
+func (e *MempoolEntry) feeRateLess(other *MempoolEntry) bool {
+	return e.Fee*other.Size < other.Fee*e.Size
+}
+
+// Mempool - это пул проверенных транзакций, которые ждут включения в блок.
+type Mempool struct {
+	chain   *BlockChain
+	mu      sync.Mutex
+	entries map[string]*MempoolEntry
+	// spent - это выходы, потраченные транзакциями мемпула, и ID тратящей транзакции.
+	spent map[outpoint]string
+	size  int
+
+	MaxSize int
+	MaxAge  time.Duration
+}
+
+// NewMempool - это функция, которая создает мемпул и загружает в него сохраненные транзакции.
+// Транзакции, которые больше не проходят проверку, удаляются.
+func NewMempool(chain *BlockChain) (*Mempool, error) {
+	pool := &Mempool{
+		chain:   chain,
+		entries: make(map[string]*MempoolEntry),
+		spent:   make(map[outpoint]string),
+		MaxSize: MaxMempoolSize,
+		MaxAge:  MaxMempoolAge,
+	}
+
+	var stored []*MempoolEntry
+	err := chain.Database.Iterate(mempoolPrefix, func(key, value []byte) error {
+		var entry MempoolEntry
+		if err := decodeGob(value, &entry); err != nil {
+			return err
+		}
+		stored = append(stored, &entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range stored {
+		if err := pool.deleteStored(entry.Tx.ID); err != nil {
+			return nil, err
+		}
+		if time.Since(time.Unix(entry.Added, 0)) > pool.MaxAge {
+			continue
+		}
+		if err := pool.add(entry.Tx, entry.Added); err != nil {
+			chain.logf("Dropping mempool transaction %x: %s", entry.Tx.ID, err)
+		}
+	}
+
+	return pool, nil
+}
+
+// Add - это функция, которая проверяет транзакцию и добавляет ее в мемпул.
+func (pool *Mempool) Add(tx *Transaction) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if err := pool.expire(); err != nil {
+		return err
+	}
+	return pool.add(tx, time.Now().Unix())
+}
+
+// add - это функция, которая добавляет транзакцию в мемпул. Вызывается под блокировкой.
+func (pool *Mempool) add(tx *Transaction, added int64) error {
+	txID := hex.EncodeToString(tx.ID)
+	if _, ok := pool.entries[txID]; ok {
+		return ErrMempoolExists
+	}
+	if tx.IsCoinbase() {
+		return fmt.Errorf("%w: coinbase outside of a block", ErrBadTransaction)
+	}
+	// Транзакция могла прийти от другого узла, поэтому сначала проверяем правила, не зависящие от блокчейна.
+	if err := CheckTransactionSanity(tx); err != nil {
+		return err
+	}
+	for _, in := range tx.Inputes {
+		if other, ok := pool.spent[outpoint{hex.EncodeToString(in.ID), in.Out}]; ok {
+			return fmt.Errorf("%w: conflicts with %s", ErrMempoolConflict, other)
+		}
+	}
+	fee, err := pool.chain.ValidateTransactions([]*Transaction{tx})
+	if err != nil {
+		return err
+	}
+
+	entry := &MempoolEntry{tx, fee, len(tx.Serialize()), added}
+
+	// Если места нет, вытесняем транзакции с меньшей комиссией за байт, но только если их хватит.
+	if pool.size+entry.Size > pool.MaxSize {
+		var victims []*MempoolEntry
+		freed := 0
+		for _, e := range pool.sorted() {
+			if pool.size-freed+entry.Size <= pool.MaxSize {
+				break
+			}
+			if !e.feeRateLess(entry) {
+				return ErrMempoolFull
+			}
+			victims = append(victims, e)
+			freed += e.Size
+		}
+		for _, e := range victims {
+			if err := pool.remove(e.Tx.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	pool.entries[txID] = entry
+	pool.size += entry.Size
+	for _, in := range tx.Inputes {
+		pool.spent[outpoint{hex.EncodeToString(in.ID), in.Out}] = txID
+	}
+
+	var buffer bytes.Buffer
+	err = gob.NewEncoder(&buffer).Encode(entry)
+	handle(err)
+	return pool.chain.Database.Put(prefixedKey(mempoolPrefix, tx.ID), buffer.Bytes())
+}
+
+// sorted - это функция, которая возвращает записи от меньшей комиссии за байт к большей.
+// При равной комиссии раньше идут более новые транзакции.
+func (pool *Mempool) sorted() []*MempoolEntry {
+	entries := make([]*MempoolEntry, 0, len(pool.entries))
+	for _, e := range pool.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].feeRateLess(entries[j]) {
+			return true
+		}
+		if entries[j].feeRateLess(entries[i]) {
+			return false
+		}
+		return entries[i].Added > entries[j].Added
+	})
+	return entries
+}
+
+// remove - это функция, которая удаляет транзакцию из мемпула. Вызывается под блокировкой.
+func (pool *Mempool) remove(txID []byte) error {
+	key := hex.EncodeToString(txID)
+	entry, ok := pool.entries[key]
+	if !ok {
+		return nil
+	}
+	for _, in := range entry.Tx.Inputes {
+		delete(pool.spent, outpoint{hex.EncodeToString(in.ID), in.Out})
+	}
+	delete(pool.entries, key)
+	pool.size -= entry.Size
+	return pool.deleteStored(txID)
+}
+
+// deleteStored - это функция, которая удаляет транзакцию мемпула из базы данных.
+func (pool *Mempool) deleteStored(txID []byte) error {
+	return pool.chain.Database.Delete(prefixedKey(mempoolPrefix, txID))
+}
+
+// expire - это функция, которая удаляет транзакции, ждущие дольше MaxAge. Вызывается под блокировкой.
+func (pool *Mempool) expire() error {
+	for _, entry := range pool.entries {
+		if time.Since(time.Unix(entry.Added, 0)) > pool.MaxAge {
+			if err := pool.remove(entry.Tx.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveBlock - это функция, которая убирает из мемпула транзакции, попавшие в блок,
+// и транзакции, которые тратят те же выходы.
+func (pool *Mempool) RemoveBlock(block *Block) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for _, tx := range block.Transactions {
+		if err := pool.remove(tx.ID); err != nil {
+			return err
+		}
+		for _, in := range tx.Inputes {
+			if other, ok := pool.spent[outpoint{hex.EncodeToString(in.ID), in.Out}]; ok {
+				otherID, err := hex.DecodeString(other)
+				if err != nil {
+					return err
+				}
+				if err := pool.remove(otherID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// BlockTemplate - это функция, которая выбирает транзакции для нового блока.
+// Транзакции берутся от большей комиссии за байт к меньшей, пока не наберется maxSize байт.
+// Каждая транзакция заново проверяется против UTXOSet: те, что больше не проходят проверку, удаляются из мемпула.
+func (pool *Mempool) BlockTemplate(maxSize int) ([]*Transaction, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	validator, err := pool.chain.newTxValidator()
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*Transaction
+	size := 0
+	entries := pool.sorted()
+	for i := len(entries) - 1; i >= 0; i-- {
+		if size+entries[i].Size > maxSize {
+			continue
+		}
+		if _, err := validator.add(entries[i].Tx); err != nil {
+			if err := pool.remove(entries[i].Tx.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		txs = append(txs, entries[i].Tx)
+		size += entries[i].Size
+	}
+	return txs, nil
+}
+
+// Spends - это функция, которая проверяет, тратит ли какая-нибудь транзакция мемпула выход outIdx транзакции txID.
+func (pool *Mempool) Spends(txID []byte, outIdx int) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	_, ok := pool.spent[outpoint{hex.EncodeToString(txID), outIdx}]
+	return ok
+}
+
+// Count - это функция, которая возвращает число транзакций в мемпуле.
+func (pool *Mempool) Count() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return len(pool.entries)
+}
+
+// Contains - это функция, которая проверяет, есть ли транзакция в мемпуле.
+func (pool *Mempool) Contains(txID []byte) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	_, ok := pool.entries[hex.EncodeToString(txID)]
+	return ok
+}
+
+// Get - это функция, которая возвращает транзакцию мемпула по ее ID.
+func (pool *Mempool) Get(txID []byte) (*Transaction, bool) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	entry, ok := pool.entries[hex.EncodeToString(txID)]
+	if !ok {
+		return nil, false
+	}
+	return entry.Tx, true
+}
+
+// TxIDs - это функция, которая возвращает ID всех транзакций мемпула.
+func (pool *Mempool) TxIDs() [][]byte {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	ids := make([][]byte, 0, len(pool.entries))
+	for _, entry := range pool.entries {
+		ids = append(ids, entry.Tx.ID)
+	}
+	return ids
+}
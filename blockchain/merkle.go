@@ -0,0 +1,114 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+// MerkleTree - это дерево хэшей транзакций блока.
+// Его корень фиксирует все транзакции, а путь от листа до корня доказывает,
+// что транзакция входит в блок, без передачи всего блока.
+type MerkleTree struct {
+	RootNode *MerkleNode
+	// levels - это уровни дерева от листьев до корня, нужны для построения доказательств.
+	levels [][]*MerkleNode
+}
+
+// MerkleNode - это узел дерева Меркла.
+type MerkleNode struct {
+	Left  *MerkleNode
+	Right *MerkleNode
+	Data  []byte
+}
+
+// MerkleProofStep - это один шаг доказательства включения.
+// Hash - это хэш соседнего узла, Left - лежит ли сосед слева.
+type MerkleProofStep struct {
+	Hash []byte
+	Left bool
+}
+
+// NewMerkleNode - это функция, которая создает узел дерева.
+// Лист хранит данные как есть, внутренний узел - хэш склеенных детей.
+func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
+	node := MerkleNode{}
+
+	if left == nil && right == nil {
+		node.Data = data
+	} else {
+		node.Data = hashPair(left.Data, right.Data)
+	}
+
+	node.Left = left
+	node.Right = right
+
+	return &node
+}
+
+// hashPair - это функция, которая хэширует два соседних узла.
+func hashPair(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+	return hash[:]
+}
+
+// NewMerkleTree - это функция, которая строит дерево Меркла по списку листьев.
+// Если на уровне нечетное число узлов, последний узел дублируется.
+func NewMerkleTree(data [][]byte) *MerkleTree {
+	if len(data) == 0 {
+		empty := sha256.Sum256([]byte{})
+		root := NewMerkleNode(nil, nil, empty[:])
+		return &MerkleTree{root, [][]*MerkleNode{{root}}}
+	}
+
+	var nodes []*MerkleNode
+	for _, datum := range data {
+		nodes = append(nodes, NewMerkleNode(nil, nil, datum))
+	}
+
+	levels := [][]*MerkleNode{nodes}
+	for len(nodes) > 1 {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+			levels[len(levels)-1] = nodes
+		}
+
+		var level []*MerkleNode
+		for i := 0; i < len(nodes); i += 2 {
+			level = append(level, NewMerkleNode(nodes[i], nodes[i+1], nil))
+		}
+		levels = append(levels, level)
+		nodes = level
+	}
+
+	return &MerkleTree{nodes[0], levels}
+}
+
+// Proof - это функция, которая строит доказательство включения для листа с номером index.
+func (t *MerkleTree) Proof(index int) []MerkleProofStep {
+	var proof []MerkleProofStep
+
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if index%2 == 0 {
+			proof = append(proof, MerkleProofStep{level[index+1].Data, false})
+		} else {
+			proof = append(proof, MerkleProofStep{level[index-1].Data, true})
+		}
+		index /= 2
+	}
+
+	return proof
+}
+
+// VerifyMerkleProof - это функция, которая проверяет, что транзакция txID входит в дерево с корнем root.
+// Для проверки нужен только корень из заголовка блока и доказательство.
+func VerifyMerkleProof(root, txID []byte, proof []MerkleProofStep) bool {
+	hash := txID
+	for _, step := range proof {
+		if step.Left {
+			hash = hashPair(step.Hash, hash)
+		} else {
+			hash = hashPair(hash, step.Hash)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
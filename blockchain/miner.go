@@ -0,0 +1,158 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hashBatch - это сколько хэшей воркер считает между проверками отмены и обновлениями счетчика.
+const hashBatch = 1 << 12
+
+// ErrNonceSpaceExhausted - это ошибка, когда nonce перебраны, а extra-nonce сменить нельзя.
+var ErrNonceSpaceExhausted = errors.New("nonce space exhausted and block has no coinbase to roll")
+
+// Miner - это параллельный майнер доказательства работы.
+// Пространство nonce делится между Workers горутинами: воркер i перебирает i, i+Workers, i+2*Workers...
+type Miner struct {
+	// Workers - это число горутин, которые перебирают nonce.
+	Workers int
+	// MaxNonce - это наибольший nonce. Когда все nonce перебраны, в coinbase меняется extra-nonce.
+	MaxNonce int
+	// OnHashRate - это функция, которая раз в ReportInterval получает скорость майнинга в хэшах в секунду.
+	OnHashRate func(hashesPerSecond float64)
+	// ReportInterval - это как часто вызывается OnHashRate.
+	ReportInterval time.Duration
+}
+
+// NewMiner - это функция, которая создает майнер, использующий все процессоры.
+func NewMiner() *Miner {
+	return &Miner{
+		Workers:        runtime.NumCPU(),
+		MaxNonce:       math.MaxInt64,
+		ReportInterval: time.Second,
+	}
+}
+
+// Mine - это функция, которая подбирает nonce для блока и записывает в блок nonce и хэш.
+// Майнинг прекращается с ошибкой ctx.Err(), если контекст отменен, например, когда пришел конкурирующий блок.
+func (m *Miner) Mine(ctx context.Context, block *Block) error {
+	workers := m.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var hashes uint64
+	if m.OnHashRate != nil && m.ReportInterval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go m.reportHashRate(&hashes, stop)
+	}
+
+	for {
+		nonce, hash, found := m.search(ctx, block, workers, &hashes)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if found {
+			block.Nonce = nonce
+			block.Hash = hash
+			return nil
+		}
+		// Все nonce перебраны: меняем extra-nonce в coinbase, чтобы получить новый корень Меркла.
+		if err := block.RollExtraNonce(); err != nil {
+			return err
+		}
+	}
+}
+
+// search - это функция, которая перебирает все nonce текущего заголовка в workers горутинах.
+func (m *Miner) search(ctx context.Context, block *Block, workers int, hashes *uint64) (int, []byte, bool) {
+	pow := NewProof(block)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once   sync.Once
+		wg     sync.WaitGroup
+		nonce  int
+		result []byte
+		found  bool
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(start int) {
+			defer wg.Done()
+			n, hash, ok := m.work(ctx, pow, start, workers, hashes)
+			if ok {
+				once.Do(func() {
+					nonce, result, found = n, hash, true
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return nonce, result, found
+}
+
+// work - это функция одного воркера: перебирает nonce start, start+step, ... до MaxNonce.
+func (m *Miner) work(ctx context.Context, pow *ProofOfWork, start, step int, hashes *uint64) (int, []byte, bool) {
+	var intHash big.Int
+	// Заголовок сериализуется один раз, дальше в нем меняется только nonce.
+	data := pow.InitData(0)
+	offset := len(data) - 2*8
+
+	count := 0
+	for nonce := start; nonce <= m.MaxNonce; nonce += step {
+		binary.BigEndian.PutUint64(data[offset:], uint64(nonce))
+		hash := sha256.Sum256(data)
+		intHash.SetBytes(hash[:])
+		if intHash.Cmp(pow.Target) == -1 {
+			atomic.AddUint64(hashes, uint64(count+1))
+			return nonce, hash[:], true
+		}
+
+		count++
+		if count == hashBatch {
+			atomic.AddUint64(hashes, uint64(count))
+			count = 0
+			if ctx.Err() != nil {
+				return 0, nil, false
+			}
+		}
+		// Следующий nonce не должен переполнить int.
+		if nonce > m.MaxNonce-step {
+			break
+		}
+	}
+	atomic.AddUint64(hashes, uint64(count))
+	return 0, nil, false
+}
+
+// reportHashRate - это функция, которая раз в ReportInterval передает в OnHashRate скорость майнинга.
+func (m *Miner) reportHashRate(hashes *uint64, stop chan struct{}) {
+	ticker := time.NewTicker(m.ReportInterval)
+	defer ticker.Stop()
+
+	last := uint64(0)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			current := atomic.LoadUint64(hashes)
+			m.OnHashRate(float64(current-last) / m.ReportInterval.Seconds())
+			last = current
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fenix1851/golang-blockchain/wallet"
+)
+
+// sigPartLen - это длина r и s в подписях блоков и транзакций: подпись - это r и s, дополненные нулями до 32 байт.
+const sigPartLen = 32
+
+// Ошибки механизма доказательства полномочий.
+var (
+	ErrNoSigners          = errors.New("proof of authority needs at least one signer")
+	ErrUnauthorizedSigner = errors.New("block signer is not authorised")
+	ErrSignerOutOfTurn    = errors.New("block signer is not in turn")
+	ErrBadSealSignature   = errors.New("invalid block signature")
+)
+
+// PoAEngine - это механизм консенсуса доказательства полномочий.
+// Блоки запечатывают подписанты из списка Signers по очереди: блок высоты h подписывает Signers[h % len(Signers)].
+// Перебора nonce нет, поэтому у всех блоков нулевая сложность и при выборе ветки побеждает самая длинная.
+type PoAEngine struct {
+	// Signers - это публичные ключи подписантов (wallet.Wallet.PublicKey) в порядке очереди.
+	Signers [][]byte
+	// Wallets - это кошельки подписантов, ключи которых есть у этого узла.
+	// Узел без кошельков подписантов может только проверять блоки.
+	Wallets []*wallet.Wallet
+}
+
+// NewPoAEngine - это функция, которая создает механизм доказательства полномочий.
+// signers - это публичные ключи подписантов, wallets - кошельки подписантов, которыми этот узел подписывает блоки.
+func NewPoAEngine(signers [][]byte, wallets ...*wallet.Wallet) (*PoAEngine, error) {
+	if len(signers) == 0 {
+		return nil, ErrNoSigners
+	}
+	return &PoAEngine{Signers: signers, Wallets: wallets}, nil
+}
+
+// InTurn - это функция, которая возвращает публичный ключ подписанта, чья очередь запечатать блок высоты height.
+func (e *PoAEngine) InTurn(height int) []byte {
+	return e.Signers[height%len(e.Signers)]
+}
+
+// Prepare - это функция, которая обнуляет сложность блока.
+func (e *PoAEngine) Prepare(chain *BlockChain, block *Block) error {
+	if len(e.Signers) == 0 {
+		return ErrNoSigners
+	}
+	block.Bits = 0
+	return nil
+}
+
+// Seal - это функция, которая подписывает заголовок блока ключом подписанта, чья сейчас очередь.
+// Если ключа этого подписанта нет у узла, блок не запечатывается.
+func (e *PoAEngine) Seal(ctx context.Context, chain *BlockChain, block *Block) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(e.Signers) == 0 {
+		return ErrNoSigners
+	}
+	signer := e.InTurn(block.Height)
+	var w *wallet.Wallet
+	for _, candidate := range e.Wallets {
+		if bytes.Equal(candidate.PublicKey, signer) {
+			w = candidate
+			break
+		}
+	}
+	if w == nil {
+		return fmt.Errorf("%w: height %d belongs to %x", ErrSignerOutOfTurn, block.Height, signer)
+	}
+
+	block.Hash = headerHash(block)
+	r, s, err := ecdsa.Sign(rand.Reader, &w.PrivateKey, block.Hash)
+	if err != nil {
+		return err
+	}
+	signature := make([]byte, 2*sigPartLen)
+	r.FillBytes(signature[:sigPartLen])
+	s.FillBytes(signature[sigPartLen:])
+
+	block.Signer = w.PublicKey
+	block.Signature = signature
+	return nil
+}
+
+// VerifyHeader - это функция, которая проверяет, что блок подписан подписантом из списка,
+// что была его очередь и что подпись заголовка действительна.
+func (e *PoAEngine) VerifyHeader(chain *BlockChain, block *Block) error {
+	if len(e.Signers) == 0 {
+		return ErrNoSigners
+	}
+	if block.Bits != 0 {
+		return fmt.Errorf("%w: proof of authority block has bits %d", ErrInvalidProof, block.Bits)
+	}
+	if !bytes.Equal(block.Hash, headerHash(block)) {
+		return ErrBadBlockHash
+	}
+
+	authorised := false
+	for _, signer := range e.Signers {
+		if bytes.Equal(signer, block.Signer) {
+			authorised = true
+			break
+		}
+	}
+	if !authorised {
+		return fmt.Errorf("%w: %x", ErrUnauthorizedSigner, block.Signer)
+	}
+	if !bytes.Equal(block.Signer, e.InTurn(block.Height)) {
+		return fmt.Errorf("%w: %x at height %d", ErrSignerOutOfTurn, block.Signer, block.Height)
+	}
+
+	if len(block.Signature) != 2*sigPartLen || len(block.Signer) != wallet.PublicKeyLen {
+		return ErrBadSealSignature
+	}
+	// Публичный ключ - это склеенные X и Y, как в wallet.Wallet.
+	r := new(big.Int).SetBytes(block.Signature[:sigPartLen])
+	s := new(big.Int).SetBytes(block.Signature[sigPartLen:])
+	keyLen := len(block.Signer)
+	x := new(big.Int).SetBytes(block.Signer[:keyLen/2])
+	y := new(big.Int).SetBytes(block.Signer[keyLen/2:])
+
+	pubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	if !ecdsa.Verify(&pubKey, block.Hash, r, s) {
+		return ErrBadSealSignature
+	}
+	return nil
+}
+
+// VerifySeal - это функция, которая проверяет заголовок так же, как VerifyHeader: родитель для этого не нужен.
+func (e *PoAEngine) VerifySeal(chain *BlockChain, block *Block) error {
+	return e.VerifyHeader(chain, block)
+}
@@ -14,18 +14,12 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
-	"fmt"
-	"log"
-	"math"
 	"math/big"
 )
 
-// Difficulty - это сложность нашего майнинга
-// Чем больше сложность, тем больше нулей должно быть в начале хэша
-const Difficulty = 18
-
 // ProofOfWork - это структура данных, которая хранит в себе блок и целевое значение
 // Целевое значение - это число, которое должно быть больше, чем хэш блока
 // Чем больше сложность, тем больше нулей должно быть в начале хэша
@@ -36,9 +30,12 @@ type ProofOfWork struct {
 
 // NewProof - это функция, которая создает новый ProofOfWork
 // Для этого она создает новый ProofOfWork и присваивает ему блок и целевое значение
+// Для сложности вне границ [0, MaxDifficulty] целевое значение равно 0, и такой блок не проходит Validate
 func NewProof(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-Difficulty))
+	target := big.NewInt(0)
+	if b.Bits >= 0 && b.Bits <= MaxDifficulty {
+		target.Lsh(big.NewInt(1), uint(256-b.Bits))
+	}
 
 	pow := &ProofOfWork{b, target}
 
@@ -59,28 +56,34 @@ func (pow *ProofOfWork) Validate() bool {
 	return intHash.Cmp(pow.Target) == -1
 }
 
+// ValidateBits - это функция, которая проверяет блок против сложности, ожидаемой для его высоты
+// Блок с заниженной сложностью недействителен, даже если его хэш меньше его собственного целевого значения
+func (pow *ProofOfWork) ValidateBits(expectedBits int) bool {
+	return pow.Block.Bits == expectedBits && pow.Validate()
+}
+
 // ToHex - это функция, которая преобразует число в байты
 // Это нужно для того, чтобы мы могли добавить nonce в хэш
 func ToHex(num int64) []byte {
-	buff := new(bytes.Buffer)
-	err := binary.Write(buff, binary.BigEndian, num)
-	if err != nil {
-		log.Panic(err)
-	}
-
-	return buff.Bytes()
+	buff := make([]byte, 8)
+	binary.BigEndian.PutUint64(buff, uint64(num))
+	return buff
 }
 
-// InitData - это функция, которая объединяет данные в один слайс байтов
+// InitData - это функция, которая объединяет поля заголовка блока в один слайс байтов
 // Это нужно для того, чтобы мы могли добавить nonce в хэш
 // nonce - это число, которое мы будем увеличивать, пока хэш не будет начинаться с 4 нулей
 func (pow *ProofOfWork) InitData(nonce int) []byte {
+	header := pow.Block.BlockHeader
 	data := bytes.Join(
 		[][]byte{
-			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
-			ToHex(int64(Difficulty)),
+			ToHex(int64(header.Version)),
+			header.PrevHash,
+			header.MerkleRoot,
+			ToHex(header.Timestamp),
+			ToHex(int64(header.Bits)),
 			ToHex(int64(nonce)),
+			ToHex(int64(header.Height)),
 		},
 		[]byte{},
 	)
@@ -90,38 +93,14 @@ func (pow *ProofOfWork) InitData(nonce int) []byte {
 
 // Run - это функция, которая выполняет майнинг
 // Мы возьмём дату из блока
-// Поставим nonce в 0
-// Мы будем увеличивать nonce, пока хэш не будет начинаться с 4 нулей
-// Когда мы найдём nonce, который даст нам хэш, который начинается с 4 нулей, мы сможем сказать, что мы выполнили некоторую работу
+// Будем перебирать nonce во всех процессорах, пока хэш не станет меньше целевого значения
+// Когда мы найдём такой nonce, мы сможем сказать, что мы выполнили некоторую работу
 // и мы сможем добавить блок в блокчейн
-func (pow *ProofOfWork) Run() (int, []byte) {
-	// Создаём переменную, которая будет хранить хэш в виде big.Int
-	var intHash big.Int
-	// Создаём переменную, которая будет хранить хэш в виде слайса байтов
-	var hash [32]byte
-	// Создаём переменную, которая будет хранить nonce
-	nonce := 0
-
-	// Будем увеличивать nonce, пока хэш не будет начинаться с 4 нулей
-	for nonce < math.MaxInt64 {
-		// Создаём слайс байтов, который будет хранить данные
-		data := pow.InitData(nonce)
-		// Вычисляем хэш
-		hash = sha256.Sum256(data)
-		// Выводим хэш в консоль
-		fmt.Printf("\r%x", hash)
-		// Преобразуем хэш в big.Int
-		intHash.SetBytes(hash[:])
-		// Сравниваем хэш с целевым значением
-		if intHash.Cmp(pow.Target) == -1 {
-			break
-		} else {
-			nonce++
-		}
+// Если nonce закончатся, в coinbase блока сменится extra-nonce
+func (pow *ProofOfWork) Run() (int, []byte, error) {
+	if err := NewMiner().Mine(context.Background(), pow.Block); err != nil {
+		return 0, nil, err
 	}
-	// Выводим пустую строку в консоль
-	fmt.Println()
 	// Возвращаем nonce и хэш
-	return nonce, hash[:]
-
+	return pow.Block.Nonce, pow.Block.Hash, nil
 }
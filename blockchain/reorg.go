@@ -0,0 +1,202 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+)
+
+var (
+	// workPrefix - это префикс ключей, под которыми хранится суммарная работа цепочки до блока.
+	workPrefix = []byte("work-")
+	// invalidPrefix - это префикс ключей блоков, которые не прошли проверку транзакций при переходе на их ветку.
+	invalidPrefix = []byte("invalid-")
+)
+
+// BlockWork - это функция, которая возвращает работу, нужную для блока со сложностью bits.
+// Целевое значение равно 2^(256-bits), поэтому в среднем нужно перебрать 2^bits хэшей.
+func BlockWork(bits int) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits))
+}
+
+// Work - это функция, которая возвращает суммарную работу цепочки от генезис-блока до блока blockHash.
+func (chain *BlockChain) Work(blockHash []byte) (*big.Int, error) {
+	data, err := chain.Database.Get(prefixedKey(workPrefix, blockHash))
+	if err != nil {
+		return new(big.Int), err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// isInvalid - это функция, которая проверяет, помечен ли блок как недействительный.
+func (chain *BlockChain) isInvalid(blockHash []byte) bool {
+	_, err := chain.Database.Get(prefixedKey(invalidPrefix, blockHash))
+	return err == nil
+}
+
+// storeBlock - это функция, которая сохраняет блок и суммарную работу его цепочки, не делая его последним.
+func (chain *BlockChain) storeBlock(block *Block, work *big.Int) error {
+	batch := chain.Database.NewBatch()
+	if err := batch.Put(block.Hash, block.Serialize()); err != nil {
+		return err
+	}
+	if err := batch.Put(prefixedKey(workPrefix, block.Hash), work.Bytes()); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// connectBlock - это функция, которая делает блок последним в блокчейне и применяет его к UTXOSet.
+// Блок должен продолжать текущий последний блок.
+func (chain *BlockChain) connectBlock(block *Block) error {
+	batch := chain.Database.NewBatch()
+	if err := batch.Put(lastHashKey, block.Hash); err != nil {
+		return err
+	}
+	if err := batch.Put(heightKey(block.Height), block.Hash); err != nil {
+		return err
+	}
+	if err := updateUTXO(batch, block); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	chain.setTip(block.Hash)
+	return nil
+}
+
+// disconnectBlock - это функция, которая убирает последний блок из основной цепочки и откатывает UTXOSet.
+// Сам блок остается в базе данных как боковая ветка.
+func (chain *BlockChain) disconnectBlock(block *Block) error {
+	batch := chain.Database.NewBatch()
+	if err := batch.Put(lastHashKey, block.PrevHash); err != nil {
+		return err
+	}
+	if err := batch.Delete(heightKey(block.Height)); err != nil {
+		return err
+	}
+	if err := revertUTXO(batch, block); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	chain.setTip(block.PrevHash)
+	return nil
+}
+
+// setTip - это функция, которая делает блок hash последним и сообщает об этом тем, кто ждет TipChanged.
+func (chain *BlockChain) setTip(hash []byte) {
+	chain.tipMu.Lock()
+	defer chain.tipMu.Unlock()
+	chain.lastHash = hash
+	if chain.tipChanged != nil {
+		close(chain.tipChanged)
+		chain.tipChanged = nil
+	}
+}
+
+// TipChanged - это функция, которая возвращает канал, который закроется, когда сменится последний блок.
+// Через него майнер узнает, что его блок уже не продолжит основную цепочку.
+func (chain *BlockChain) TipChanged() <-chan struct{} {
+	chain.tipMu.Lock()
+	defer chain.tipMu.Unlock()
+	if chain.tipChanged == nil {
+		chain.tipChanged = make(chan struct{})
+	}
+	return chain.tipChanged
+}
+
+// findFork - это функция, которая ищет общего предка текущего последнего блока и newTip.
+// Она возвращает блоки, которые нужно убрать из основной цепочки (от последнего к предку),
+// и блоки, которые нужно добавить (от предка к newTip).
+func (chain *BlockChain) findFork(newTip *Block) (detach, attach []*Block, err error) {
+	oldTip, err := chain.GetBlock(chain.lastHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, b := &oldTip, newTip
+
+	step := func(block *Block) (*Block, error) {
+		prev, err := chain.GetBlock(block.PrevHash)
+		return &prev, err
+	}
+
+	for a.Height > b.Height {
+		detach = append(detach, a)
+		if a, err = step(a); err != nil {
+			return nil, nil, err
+		}
+	}
+	for b.Height > a.Height {
+		attach = append([]*Block{b}, attach...)
+		if b, err = step(b); err != nil {
+			return nil, nil, err
+		}
+	}
+	for !bytes.Equal(a.Hash, b.Hash) {
+		detach = append(detach, a)
+		attach = append([]*Block{b}, attach...)
+		if a, err = step(a); err != nil {
+			return nil, nil, err
+		}
+		if b, err = step(b); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return detach, attach, nil
+}
+
+// reorganize - это функция, которая переключает блокчейн на ветку, заканчивающуюся newTip.
+// Блоки старой ветки откатываются, блоки новой проверяются и применяются по одному.
+// Если блок новой ветки оказывается недействительным, он помечается и блокчейн возвращается на старую ветку.
+func (chain *BlockChain) reorganize(newTip *Block) error {
+	detach, attach, err := chain.findFork(newTip)
+	if err != nil {
+		return err
+	}
+
+	for _, block := range detach {
+		if err := chain.disconnectBlock(block); err != nil {
+			return err
+		}
+	}
+
+	for i, block := range attach {
+		verr := chain.validateBlockTransactions(block)
+		if verr == nil {
+			if err := chain.connectBlock(block); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Помечаем недействительным этот блок и все блоки ветки после него.
+		batch := chain.Database.NewBatch()
+		for _, bad := range attach[i:] {
+			if err := batch.Put(prefixedKey(invalidPrefix, bad.Hash), []byte{}); err != nil {
+				return err
+			}
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		// Откатываем уже примененные блоки новой ветки и возвращаем старую.
+		for j := i - 1; j >= 0; j-- {
+			if err := chain.disconnectBlock(attach[j]); err != nil {
+				return err
+			}
+		}
+		for j := len(detach) - 1; j >= 0; j-- {
+			if err := chain.connectBlock(detach[j]); err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("reorganization to %x failed: %w", newTip.Hash, verr)
+	}
+
+	chain.logf("Reorganized chain: %d blocks detached, %d attached", len(detach), len(attach))
+	return nil
+}
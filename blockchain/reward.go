@@ -0,0 +1,70 @@
+package blockchain
+
+import "github.com/fenix1851/golang-blockchain/config"
+
+const (
+	// HalvingInterval - это через сколько блоков награда за блок уменьшается вдвое.
+	HalvingInterval = 1000
+	// MaxMoney - это наибольшая сумма одного выхода, суммы выходов и суммы входов транзакции.
+	// Она больше выпуска всех сетей из config.Networks, а проверка сумм против нее не дает им переполниться.
+	MaxMoney = 1_000_000_000
+)
+
+// Subsidy - это функция, которая возвращает награду за блок на высоте height в сети params без учета комиссий.
+// Награда начинается с params.Reward и уменьшается вдвое каждые HalvingInterval блоков,
+// а когда суммарный выпуск доходит до MaxSupply, награда становится нулевой.
+func Subsidy(params *config.ChainParams, height int) int {
+	return SubsidyFor(params.Reward, height)
+}
+
+// Subsidy - это функция, которая возвращает награду за блок на высоте height в сети блокчейна.
+func (chain *BlockChain) Subsidy(height int) int {
+	return Subsidy(chain.Params, height)
+}
+
+// SubsidyFor - это функция, которая считает награду за блок на высоте height в сети с начальной наградой reward.
+// Выпуск такой сети ограничен 2 * reward * HalvingInterval монет.
+func SubsidyFor(reward, height int) int {
+	halvings := height / HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	subsidy := reward >> uint(halvings)
+
+	if left := maxSupply(reward) - issuedBefore(reward, height); subsidy > left {
+		subsidy = left
+	}
+	return subsidy
+}
+
+// MaxSupply - это функция, которая возвращает максимальное количество монет,
+// которое может быть выпущено наградами за блоки в сети params.
+func MaxSupply(params *config.ChainParams) int {
+	return maxSupply(params.Reward)
+}
+
+// IssuedBefore - это функция, которая считает, сколько монет выпущено наградами в блоках ниже height в сети params.
+func IssuedBefore(params *config.ChainParams, height int) int {
+	return issuedBefore(params.Reward, height)
+}
+
+// maxSupply - это функция, которая возвращает максимальный выпуск сети с начальной наградой reward.
+func maxSupply(reward int) int {
+	return 2 * reward * HalvingInterval
+}
+
+// issuedBefore - это функция, которая считает выпуск ниже height в сети с начальной наградой reward.
+func issuedBefore(reward, height int) int {
+	issued := 0
+	for era := 0; era < 63 && era*HalvingInterval < height; era++ {
+		blocks := HalvingInterval
+		if rest := height - era*HalvingInterval; rest < blocks {
+			blocks = rest
+		}
+		issued += blocks * (reward >> uint(era))
+	}
+	if issued > maxSupply(reward) {
+		issued = maxSupply(reward)
+	}
+	return issued
+}
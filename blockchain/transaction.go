@@ -2,10 +2,26 @@ package blockchain
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math/big"
+
+	"github.com/fenix1851/golang-blockchain/config"
+	"github.com/fenix1851/golang-blockchain/wallet"
+)
+
+// Ошибки создания транзакций.
+var (
+	ErrInsufficientFunds = errors.New("not enough funds")
+	ErrBadAddress        = errors.New("invalid address")
+	ErrFeeNotFit         = errors.New("could not fit the fee to the transaction size")
 )
 
 // Transaction - это структура данных, которая хранит в себе ID - уникальный идентификатор транзакции, Inputes - входящие транзакции, Outputs - исходящие транзакции.
@@ -15,77 +31,351 @@ type Transaction struct {
 	Outputs []TXOutput
 }
 
-// CoinbaseTx - это функция, которая создает новую транзакцию.
-func CoinbaseTx(to, data string) *Transaction {
+// FeePolicy - это правило расчета комиссии транзакции.
+// Комиссия равна Fixed плюс PerByte за каждый байт сериализованной транзакции.
+// Нулевое значение означает транзакцию без комиссии.
+type FeePolicy struct {
+	Fixed   int
+	PerByte int
+}
+
+// maxFeeRounds - это сколько раз NewTransaction пересобирает транзакцию, подгоняя комиссию под ее размер.
+const maxFeeRounds = 5
+
+// coinbaseHeaderLen - это длина высоты блока и extra-nonce в начале данных coinbase.
+const coinbaseHeaderLen = 16
+
+// CoinbaseTx - это функция, которая создает coinbase-транзакцию высоты 0 сети params.
+func CoinbaseTx(params *config.ChainParams, to, data string) (*Transaction, error) {
+	return NewCoinbaseTx(params, to, data, Subsidy(params, 0), 0, 0)
+}
+
+// NewCoinbaseTx - это функция, которая создает coinbase-транзакцию, платящую value на адрес to сети params.
+// В данные входа записываются высота блока и extraNonce, поэтому у coinbase разных блоков разные ID,
+// даже если они платят одному адресу одну и ту же сумму.
+func NewCoinbaseTx(params *config.ChainParams, to, data string, value, height int, extraNonce uint64) (*Transaction, error) {
 	// Если данные пустые, то мы присваиваем им строку "Reward to 'to'".
 	if data == "" {
 		data = fmt.Sprintf("Reward to '%s'", to)
 	}
 	// Создаем новую транзакцию.
-	txin := TXInput{[]byte{}, -1, data}
-	txout := TXOutput{100, to}
+	// У coinbase-транзакции нет подписи, поэтому в PubKey мы записываем высоту, extraNonce и произвольные данные.
+	payload := bytes.Join([][]byte{ToHex(int64(height)), ToHex(int64(extraNonce)), []byte(data)}, []byte{})
+	txin := TXInput{[]byte{}, -1, nil, payload}
+	txout, err := NewTXOutput(value, to, params.AddressVersion)
+	if err != nil {
+		return nil, err
+	}
 	// Создаем новую транзакцию.
-	tx := Transaction{nil, []TXInput{txin}, []TXOutput{txout}}
+	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
 	tx.ID = tx.Hash()
 	// Возвращаем транзакцию.
-	return &tx
+	return &tx, nil
+}
+
+// CoinbaseHeight - это функция, которая достает высоту блока из данных coinbase-транзакции.
+func (tx *Transaction) CoinbaseHeight() (int, bool) {
+	if !tx.IsCoinbase() || len(tx.Inputes[0].PubKey) < coinbaseHeaderLen {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint64(tx.Inputes[0].PubKey[:8])), true
+}
+
+// setExtraNonce - это функция, которая меняет extra-nonce в данных coinbase-транзакции и пересчитывает ее ID.
+func (tx *Transaction) setExtraNonce(extraNonce uint64) {
+	payload := append([]byte{}, tx.Inputes[0].PubKey...)
+	binary.BigEndian.PutUint64(payload[8:coinbaseHeaderLen], extraNonce)
+	tx.Inputes[0].PubKey = payload
+	tx.ID = tx.Hash()
+}
+
+// extraNonce - это функция, которая достает extra-nonce из данных coinbase-транзакции.
+func (tx *Transaction) extraNonce() uint64 {
+	return binary.BigEndian.Uint64(tx.Inputes[0].PubKey[8:coinbaseHeaderLen])
+}
+
+// Serialize - это функция, которая сериализует транзакцию.
+func (tx Transaction) Serialize() []byte {
+	var encoded bytes.Buffer
+	encoder := gob.NewEncoder(&encoded)
+	err := encoder.Encode(tx)
+	handle(err)
+	return encoded.Bytes()
+}
+
+// DeserializeTransaction - это функция, которая декодирует транзакцию, сериализованную Serialize.
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	var tx Transaction
+	if err := decodeGob(data, &tx); err != nil {
+		return nil, err
+	}
+	return &tx, nil
 }
 
 //	Hash - это функция, которая хеширует транзакцию.
+//
+// ID транзакции не участвует в хэше, поэтому мы хешируем поля транзакции без ID.
 func (tx *Transaction) Hash() []byte {
-	// encoded - это буфер, в который мы будем записывать байты.
-	var encoded bytes.Buffer
 	// hash - это хэш транзакции.
-	var hash [32]byte
-	// encode - это кодировщик, который будет кодировать транзакцию в байты.
-	encode := gob.NewEncoder(&encoded)
-	// Encode - это функция, которая кодирует транзакцию в байты.
-	err := encode.Encode(tx)
-	// Если произошла ошибка, то мы выводим ее в консоль.
-	Handle(err)
-	// Вычисляем хэш транзакции.
-	hash = sha256.Sum256(encoded.Bytes())
+	hash := sha256.Sum256(tx.hashData())
 	// Возвращаем хэш транзакции.
 	return hash[:]
 }
 
+// hashData - это функция, которая собирает поля транзакции, кроме ID, в байты для хэша.
+// Кодировка gob сюда не подходит: номера типов в ней зависят от того, в каком порядке процесс
+// впервые кодировал типы, и один и тот же ID получался бы на разных узлах разным.
+func (tx *Transaction) hashData() []byte {
+	// withLength - это поле переменной длины с длиной впереди, чтобы границы полей нельзя было сдвинуть.
+	withLength := func(data []byte) []byte {
+		return append(ToHex(int64(len(data))), data...)
+	}
+	fields := [][]byte{ToHex(int64(len(tx.Inputes)))}
+	for _, in := range tx.Inputes {
+		fields = append(fields, withLength(in.ID), ToHex(int64(in.Out)), withLength(in.Signature), withLength(in.PubKey))
+	}
+	fields = append(fields, ToHex(int64(len(tx.Outputs))))
+	for _, out := range tx.Outputs {
+		fields = append(fields, ToHex(int64(out.Value)), withLength(out.PubKeyHash))
+	}
+	return bytes.Join(fields, []byte{})
+}
+
 func (tx *Transaction) IsCoinbase() bool {
 	// Если длина входящих транзакций равна 1, то это Coinbase транзакция.
 	return len(tx.Inputes) == 1 && len(tx.Inputes[0].ID) == 0 && tx.Inputes[0].Out == -1
 }
 
-// NewTransaction - это функция, которая создает новую транзакцию.
-func NewTransaction(from, to string, amount int, bc *BlockChain) *Transaction {
-	// Создаем новую транзакцию.
+// TrimmedCopy - это функция, которая создает копию транзакции без подписей и публичных ключей во входах.
+// Именно эту копию подписывает владелец выходов.
+func (tx *Transaction) TrimmedCopy() Transaction {
 	var inputs []TXInput
 	var outputs []TXOutput
 
-	acc, validOutputs := bc.FindSpendableOutputs(from, amount)
+	for _, in := range tx.Inputes {
+		inputs = append(inputs, TXInput{in.ID, in.Out, nil, nil})
+	}
+
+	for _, out := range tx.Outputs {
+		outputs = append(outputs, TXOutput{out.Value, out.PubKeyHash})
+	}
+
+	return Transaction{tx.ID, inputs, outputs}
+}
 
-	if acc < amount {
-		fmt.Println("Not enough funds")
+// Sign - это функция, которая подписывает каждый вход транзакции приватным ключом.
+// prevTXs - это транзакции, на выходы которых ссылаются входы.
+func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) error {
+	// Coinbase-транзакции не подписываются.
+	if tx.IsCoinbase() {
 		return nil
 	}
+	prevOuts, ok := spentOutputs(tx, prevTXs)
+	if !ok {
+		return fmt.Errorf("%w: %x", ErrMissingInput, tx.ID)
+	}
+	return tx.SignOutputs(privKey, prevOuts)
+}
 
-	// Создаем входящие транзакции.
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
-		Handle(err)
+// SignOutputs - это функция, которая подписывает каждый вход транзакции приватным ключом.
+// prevOuts - это выходы, которые тратят входы: prevOuts[i] тратит i-й вход.
+// Для подписи нужен только хэш публичного ключа выхода, поэтому выходы можно взять прямо из UTXOSet.
+func (tx *Transaction) SignOutputs(privKey ecdsa.PrivateKey, prevOuts []TXOutput) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	if len(prevOuts) != len(tx.Inputes) {
+		return fmt.Errorf("%w: %d outputs for %d inputs", ErrMissingInput, len(prevOuts), len(tx.Inputes))
+	}
+
+	txCopy := tx.TrimmedCopy()
+
+	for inId := range txCopy.Inputes {
+		// На время подписи записываем во вход хэш публичного ключа из выхода, который мы тратим.
+		txCopy.Inputes[inId].Signature = nil
+		txCopy.Inputes[inId].PubKey = prevOuts[inId].PubKeyHash
+		txCopy.ID = txCopy.Hash()
+		txCopy.Inputes[inId].PubKey = nil
+
+		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
+		if err != nil {
+			return err
+		}
+		signature := make([]byte, 2*sigPartLen)
+		r.FillBytes(signature[:sigPartLen])
+		s.FillBytes(signature[sigPartLen:])
+
+		tx.Inputes[inId].Signature = signature
+	}
+	// Подписи входят в хэш транзакции, поэтому после подписи ID пересчитывается.
+	tx.ID = tx.Hash()
+	return nil
+}
+
+// Verify - это функция, которая проверяет подписи всех входов транзакции.
+// Транзакция, для входа которой нет предыдущей транзакции в prevTXs, недействительна.
+func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+	prevOuts, ok := spentOutputs(tx, prevTXs)
+	return ok && tx.VerifyOutputs(prevOuts)
+}
+
+// VerifyOutputs - это функция, которая проверяет подписи всех входов транзакции.
+// prevOuts - это выходы, которые тратят входы: prevOuts[i] тратит i-й вход.
+func (tx *Transaction) VerifyOutputs(prevOuts []TXOutput) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+	if len(prevOuts) != len(tx.Inputes) {
+		return false
+	}
+
+	txCopy := tx.TrimmedCopy()
+	curve := elliptic.P256()
+
+	for inId, in := range tx.Inputes {
+		// Вход должен предъявлять ключ, на который заблокирован тратимый выход.
+		if !in.UsesKey(prevOuts[inId].PubKeyHash) {
+			return false
+		}
+		txCopy.Inputes[inId].Signature = nil
+		txCopy.Inputes[inId].PubKey = prevOuts[inId].PubKeyHash
+		txCopy.ID = txCopy.Hash()
+		txCopy.Inputes[inId].PubKey = nil
+
+		// Подпись - это склеенные r и s, публичный ключ - склеенные X и Y, все части фиксированной длины.
+		if len(in.Signature) != 2*sigPartLen || len(in.PubKey) != wallet.PublicKeyLen {
+			return false
+		}
+		r := big.Int{}
+		s := big.Int{}
+		r.SetBytes(in.Signature[:sigPartLen])
+		s.SetBytes(in.Signature[sigPartLen:])
+
+		x := big.Int{}
+		y := big.Int{}
+		x.SetBytes(in.PubKey[:wallet.PublicKeyLen/2])
+		y.SetBytes(in.PubKey[wallet.PublicKeyLen/2:])
+
+		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
+		if !ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// spentOutputs - это функция, которая достает из prevTXs выходы, которые тратят входы транзакции.
+// Возвращает false, если для какого-то входа нет предыдущей транзакции или выхода.
+func spentOutputs(tx *Transaction, prevTXs map[string]Transaction) ([]TXOutput, bool) {
+	prevOuts := make([]TXOutput, 0, len(tx.Inputes))
+	for _, in := range tx.Inputes {
+		prevTX := prevTXs[hex.EncodeToString(in.ID)]
+		if prevTX.ID == nil || in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return nil, false
+		}
+		prevOuts = append(prevOuts, prevTX.Outputs[in.Out])
+	}
+	return prevOuts, true
+}
+
+// outputFinder - это функция, которая выбирает выходы, заблокированные на pubKeyHash, на сумму не меньше amount.
+type outputFinder func(pubKeyHash []byte, amount int) ([]SpendableOutput, error)
+
+// NewTransaction - это функция, которая создает новую транзакцию.
+// Транзакция подписывается приватным ключом кошелька отправителя.
+// Комиссия по правилу fee не попадает ни в один выход и достается майнеру.
+// Если денег не хватает на сумму и комиссию, возвращается ErrInsufficientFunds.
+func NewTransaction(w *wallet.Wallet, to string, amount int, fee FeePolicy, UTXO *UTXOSet) (*Transaction, error) {
+	return newTransaction(w, to, amount, fee, UTXO.Blockchain.Params, UTXO.SpendableOutputs)
+}
+
+// NewTransactionFromOutputs - это функция, которая создает транзакцию так же, как NewTransaction,
+// но тратит выходы из списка outs, например полученного от узла сети, а не из UTXOSet.
+func NewTransactionFromOutputs(w *wallet.Wallet, to string, amount int, fee FeePolicy, params *config.ChainParams, outs []SpendableOutput) (*Transaction, error) {
+	return newTransaction(w, to, amount, fee, params, func(pubKeyHash []byte, amount int) ([]SpendableOutput, error) {
+		var selected []SpendableOutput
+		accumulated := 0
 		for _, out := range outs {
-			input := TXInput{txID, out, from}
-			inputs = append(inputs, input)
+			if accumulated >= amount {
+				break
+			}
+			if out.Output.IsLockedWithKey(pubKeyHash) {
+				selected = append(selected, out)
+				accumulated += out.Output.Value
+			}
+		}
+		return selected, nil
+	})
+}
+
+// newTransaction - это функция, которая собирает транзакцию из выходов, выбранных find.
+func newTransaction(w *wallet.Wallet, to string, amount int, fee FeePolicy, params *config.ChainParams, find outputFinder) (*Transaction, error) {
+	// Комиссия за байт зависит от размера транзакции, а размер - от числа входов,
+	// поэтому собираем транзакцию, пока комиссии хватает на ее размер.
+	required := fee.Fixed
+	for round := 0; round < maxFeeRounds; round++ {
+		tx, err := buildTransaction(w, to, amount, required, params, find)
+		if err != nil {
+			return nil, err
+		}
+		needed := fee.Fixed + fee.PerByte*len(tx.Serialize())
+		if needed <= required {
+			return tx, nil
 		}
+		required = needed
+	}
+	return nil, ErrFeeNotFit
+}
+
+// buildTransaction - это функция, которая собирает и подписывает транзакцию с комиссией fee.
+func buildTransaction(w *wallet.Wallet, to string, amount, fee int, params *config.ChainParams, find outputFinder) (*Transaction, error) {
+	// Создаем новую транзакцию.
+	var inputs []TXInput
+	var outputs []TXOutput
+
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+	spendable, err := find(pubKeyHash, amount+fee)
+	if err != nil {
+		return nil, err
+	}
+
+	// Создаем входящие транзакции.
+	acc := 0
+	prevOuts := make([]TXOutput, 0, len(spendable))
+	for _, out := range spendable {
+		inputs = append(inputs, TXInput{out.TxID, out.Index, nil, w.PublicKey})
+		prevOuts = append(prevOuts, out.Output)
+		acc += out.Output.Value
+	}
+	if acc < amount+fee {
+		return nil, fmt.Errorf("%w: have %d, need %d", ErrInsufficientFunds, acc, amount+fee)
 	}
 
 	// Создаем исходящие транзакции.
-	outputs = append(outputs, TXOutput{amount, to})
-	if acc > amount {
-		outputs = append(outputs, TXOutput{acc - amount, from})
+	output, err := NewTXOutput(amount, to, params.AddressVersion)
+	if err != nil {
+		return nil, err
+	}
+	outputs = append(outputs, *output)
+	if acc > amount+fee {
+		// Сдача возвращается на тот же ключ, которым заблокированы потраченные выходы.
+		outputs = append(outputs, TXOutput{acc - amount - fee, pubKeyHash})
 	}
 
 	// Создаем новую транзакцию.
 	tx := Transaction{nil, inputs, outputs}
 	tx.ID = tx.Hash()
+	if err := tx.SignOutputs(w.PrivateKey, prevOuts); err != nil {
+		return nil, err
+	}
+	// Не отдаем наружу транзакцию, которая не проходит проверку подписи.
+	if !tx.VerifyOutputs(prevOuts) {
+		return nil, fmt.Errorf("%w: %x", ErrBadSignature, tx.ID)
+	}
 	// Возвращаем транзакцию.
-	return &tx
+	return &tx, nil
 }
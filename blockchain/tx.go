@@ -1,32 +1,60 @@
 package blockchain
 
-// TXInput - это структура данных, которая хранит в себе ID - уникальный идентификатор транзакции, Out - номер транзакции, Sig - подпись.
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/fenix1851/golang-blockchain/wallet"
+)
+
+// TXInput - это структура данных, которая хранит в себе ID - уникальный идентификатор транзакции, Out - номер выхода, Signature - подпись, PubKey - публичный ключ.
 type TXInput struct {
 	ID []byte
-	// Out - это номер транзакции, которая будет использоваться для проверки подписи.
+	// Out - это номер выхода транзакции, на который ссылается вход.
 	Out int
-	// Sig - это подпись, которая будет использоваться для проверки подписи.
-	Sig string
+	// Signature - это подпись ECDSA, которой владелец подтверждает право потратить выход.
+	Signature []byte
+	// PubKey - это публичный ключ владельца, которым проверяется подпись.
+	PubKey []byte
 }
 
-// TXOutput - это структура данных, которая хранит в себе Value - значение транзакции, PubKey - публичный ключ.
-
+// TXOutput - это структура данных, которая хранит в себе Value - значение транзакции, PubKeyHash - хэш публичного ключа.
 type TXOutput struct {
 	Value int
-	// PubKey - это публичный ключ, который будет использоваться для проверки подписи.
-	// Публичный ключ - это ключ, который можно открыть и прочитать.
-	PubKey string
+	// PubKeyHash - это хэш публичного ключа получателя.
+	// Потратить выход может только тот, чей публичный ключ дает этот хэш.
+	PubKeyHash []byte
+}
+
+// NewTXOutput - это функция, которая создает новый выход и блокирует его на адрес сети с байтом версии addressVersion.
+func NewTXOutput(value int, address string, addressVersion byte) (*TXOutput, error) {
+	txo := &TXOutput{value, nil}
+	if err := txo.Lock([]byte(address), addressVersion); err != nil {
+		return nil, err
+	}
+	return txo, nil
+}
+
+// UsesKey - это функция, которая проверяет, принадлежит ли вход владельцу хэша публичного ключа.
+func (in *TXInput) UsesKey(pubKeyHash []byte) bool {
+	lockingHash := wallet.PublicKeyHash(in.PubKey)
+	return bytes.Equal(lockingHash, pubKeyHash)
 }
 
-// CanUnlock - это функция, которая проверяет, может ли транзакция разблокировать выход.
-// unlockData - это данные, которые будут использоваться для проверки подписи.
-func (in *TXInput) CanUnlock(unlockData string) bool {
-	// Если подпись равна unlockData, то возвращаем true, иначе false.
-	return in.Sig == unlockData
+// Lock - это функция, которая блокирует выход на адрес.
+// Из адреса убираются байт версии и контрольная сумма, остается хэш публичного ключа.
+// Адрес с неверной контрольной суммой или адрес другой сети, чем addressVersion, не принимается:
+// иначе монеты, отправленные на адрес тестовой сети, ушли бы тому же ключу в основной.
+func (out *TXOutput) Lock(address []byte, addressVersion byte) error {
+	pubKeyHash, err := wallet.PubKeyHashForNetwork(string(address), addressVersion)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrBadAddress, address, err)
+	}
+	out.PubKeyHash = pubKeyHash
+	return nil
 }
 
-// CanBeUnlocked - это функция, которая проверяет, может ли транзакция разблокировать выход.
-// unlockData - это данные, которые будут использоваться для проверки подписи.
-func (out *TXOutput) CanBeUnlocked(unlockData string) bool {
-	return out.PubKey == unlockData
+// IsLockedWithKey - это функция, которая проверяет, заблокирован ли выход на хэш публичного ключа.
+func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
+	return bytes.Equal(out.PubKeyHash, pubKeyHash)
 }
@@ -0,0 +1,430 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+
+	"github.com/fenix1851/golang-blockchain/storage"
+)
+
+var (
+	// utxoPrefix - это префикс ключей индекса непотраченных выходов в базе данных.
+	utxoPrefix = []byte("utxo-")
+	prefixLen  = len(utxoPrefix)
+	// undoPrefix - это префикс ключей, под которыми хранятся выходы, потраченные блоком.
+	// По ним UTXOSet можно откатить при переходе на другую ветку.
+	undoPrefix = []byte("undo-")
+)
+
+// deleteBatchSize - это количество ключей, которые удаляются или записываются одним пакетом хранилища.
+const deleteBatchSize = 100000
+
+// UTXOSet - это индекс непотраченных выходов транзакций.
+// Он хранится в той же базе данных, что и блоки, но под своим префиксом,
+// поэтому для поиска баланса не нужно обходить весь блокчейн.
+type UTXOSet struct {
+	Blockchain *BlockChain
+	// Mempool - это мемпул, выходы, потраченные его транзакциями, не выбираются для новых транзакций.
+	// Может быть nil, тогда учитывается только блокчейн.
+	Mempool *Mempool
+}
+
+// TXOutputs - это непотраченные выходы одной транзакции.
+// Ключ - это номер выхода в транзакции.
+// Coinbase и Height нужны, чтобы не тратить незрелые выходы coinbase.
+type TXOutputs struct {
+	Outputs  map[int]TXOutput
+	Coinbase bool
+	Height   int
+}
+
+// newTXOutputs - это функция, которая создает пустой набор выходов транзакции из блока высоты height.
+func newTXOutputs(coinbase bool, height int) TXOutputs {
+	return TXOutputs{make(map[int]TXOutput), coinbase, height}
+}
+
+// IsMature - это функция, которая проверяет, можно ли тратить выходы в блоке высоты spendHeight.
+// maturity - это сколько блоков должно пройти после coinbase, см. config.ChainParams.CoinbaseMaturity.
+func (outs TXOutputs) IsMature(spendHeight, maturity int) bool {
+	return !outs.Coinbase || spendHeight-outs.Height >= maturity
+}
+
+// Serialize - это функция, которая сериализует выходы.
+func (outs TXOutputs) Serialize() []byte {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(outs)
+	handle(err)
+	return buffer.Bytes()
+}
+
+// SpentOutput - это выход, потраченный блоком, вместе с его адресом в индексе.
+type SpentOutput struct {
+	TxID     []byte
+	Index    int
+	Output   TXOutput
+	Coinbase bool
+	Height   int
+}
+
+// serializeUndo - это функция, которая сериализует выходы, потраченные блоком.
+func serializeUndo(spent []SpentOutput) []byte {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(spent)
+	handle(err)
+	return buffer.Bytes()
+}
+
+// deserializeUndo - это функция, которая десериализует выходы, потраченные блоком.
+func deserializeUndo(data []byte) ([]SpentOutput, error) {
+	var spent []SpentOutput
+	if err := decodeGob(data, &spent); err != nil {
+		return nil, err
+	}
+	return spent, nil
+}
+
+// DeserializeOutputs - это функция, которая десериализует выходы.
+func DeserializeOutputs(data []byte) (TXOutputs, error) {
+	var outputs TXOutputs
+	if err := decodeGob(data, &outputs); err != nil {
+		return TXOutputs{}, err
+	}
+	return outputs, nil
+}
+
+// SpendableOutput - это непотраченный выход вместе со ссылкой на него: ID транзакции и номером выхода.
+type SpendableOutput struct {
+	TxID   []byte
+	Index  int
+	Output TXOutput
+}
+
+// SpendableOutputs - это функция, которая находит выходы, заблокированные на pubKeyHash, на сумму не меньше amount.
+// Незрелые выходы coinbase и выходы, уже потраченные транзакциями мемпула, не выбираются.
+// Если таких выходов не хватает на amount, возвращаются все.
+func (u UTXOSet) SpendableOutputs(pubKeyHash []byte, amount int) ([]SpendableOutput, error) {
+	var spendable []SpendableOutput
+	accumulated := 0
+	bestHeight, err := u.Blockchain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	spendHeight := bestHeight + 1
+
+	err = u.Blockchain.Database.Iterate(utxoPrefix, func(key, value []byte) error {
+		outs, err := DeserializeOutputs(value)
+		if err != nil {
+			return err
+		}
+		if !outs.IsMature(spendHeight, u.Blockchain.Params.CoinbaseMaturity) {
+			return nil
+		}
+
+		for outIdx, out := range outs.Outputs {
+			if u.Mempool != nil && u.Mempool.Spends(key[prefixLen:], outIdx) {
+				continue
+			}
+			if out.IsLockedWithKey(pubKeyHash) {
+				// Ключ принадлежит хранилищу только до конца обхода, поэтому копируем ID.
+				txID := append([]byte{}, key[prefixLen:]...)
+				spendable = append(spendable, SpendableOutput{txID, outIdx, out})
+				accumulated += out.Value
+				if accumulated >= amount {
+					return storage.ErrStopIteration
+				}
+			}
+		}
+		return nil
+	})
+	return spendable, err
+}
+
+// FindSpendableOutputs - это функция, которая находит непотраченные выходы на сумму не меньше amount, см. SpendableOutputs.
+// Она возвращает накопленную сумму и номера выходов, сгруппированные по ID транзакции.
+func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int, error) {
+	spendable, err := u.SpendableOutputs(pubKeyHash, amount)
+	if err != nil {
+		return 0, nil, err
+	}
+	unspentOuts := make(map[string][]int)
+	accumulated := 0
+	for _, out := range spendable {
+		txID := hex.EncodeToString(out.TxID)
+		unspentOuts[txID] = append(unspentOuts[txID], out.Index)
+		accumulated += out.Output.Value
+	}
+	return accumulated, unspentOuts, nil
+}
+
+// FindUTXO - это функция, которая находит все непотраченные выходы, заблокированные на хэш публичного ключа.
+func (u UTXOSet) FindUTXO(pubKeyHash []byte) ([]TXOutput, error) {
+	var UTXOs []TXOutput
+
+	err := u.Blockchain.Database.Iterate(utxoPrefix, func(key, value []byte) error {
+		outs, err := DeserializeOutputs(value)
+		if err != nil {
+			return err
+		}
+
+		for _, out := range outs.Outputs {
+			if out.IsLockedWithKey(pubKeyHash) {
+				UTXOs = append(UTXOs, out)
+			}
+		}
+		return nil
+	})
+	return UTXOs, err
+}
+
+// Balance - это функция, которая считает баланс хэша публичного ключа.
+// confirmed - это сумма выходов, которые можно тратить, immature - сумма незрелых выходов coinbase.
+func (u UTXOSet) Balance(pubKeyHash []byte) (confirmed, immature int, err error) {
+	bestHeight, err := u.Blockchain.GetBestHeight()
+	if err != nil {
+		return 0, 0, err
+	}
+	spendHeight := bestHeight + 1
+
+	err = u.Blockchain.Database.Iterate(utxoPrefix, func(key, value []byte) error {
+		outs, err := DeserializeOutputs(value)
+		if err != nil {
+			return err
+		}
+
+		for _, out := range outs.Outputs {
+			if !out.IsLockedWithKey(pubKeyHash) {
+				continue
+			}
+			if outs.IsMature(spendHeight, u.Blockchain.Params.CoinbaseMaturity) {
+				confirmed += out.Value
+			} else {
+				immature += out.Value
+			}
+		}
+		return nil
+	})
+	return confirmed, immature, err
+}
+
+// FindOutput - это функция, которая ищет в индексе непотраченный выход outIdx транзакции txID.
+func (u UTXOSet) FindOutput(txID []byte, outIdx int) (TXOutput, bool, error) {
+	outs, found, err := u.FindOutputs(txID)
+	if !found {
+		return TXOutput{}, false, err
+	}
+	out, found := outs.Outputs[outIdx]
+	return out, found, nil
+}
+
+// FindOutputs - это функция, которая ищет в индексе все непотраченные выходы транзакции txID.
+func (u UTXOSet) FindOutputs(txID []byte) (TXOutputs, bool, error) {
+	data, err := u.Blockchain.Database.Get(prefixedKey(utxoPrefix, txID))
+	if err == storage.ErrNotFound {
+		return TXOutputs{}, false, nil
+	}
+	if err != nil {
+		return TXOutputs{}, false, err
+	}
+	outs, err := DeserializeOutputs(data)
+	if err != nil {
+		return TXOutputs{}, false, err
+	}
+	return outs, true, nil
+}
+
+// HasTransaction - это функция, которая проверяет, есть ли в индексе непотраченные выходы транзакции txID.
+func (u UTXOSet) HasTransaction(txID []byte) (bool, error) {
+	_, err := u.Blockchain.Database.Get(prefixedKey(utxoPrefix, txID))
+	if err == storage.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CountTransactions - это функция, которая считает транзакции, у которых есть непотраченные выходы.
+func (u UTXOSet) CountTransactions() (int, error) {
+	counter := 0
+
+	err := u.Blockchain.Database.Iterate(utxoPrefix, func(key, value []byte) error {
+		counter++
+		return nil
+	})
+	return counter, err
+}
+
+// Reindex - это функция, которая заново строит индекс по всему блокчейну.
+// Выходы записываются пачками по deleteBatchSize, чтобы пакет поместился в транзакцию хранилища.
+func (u UTXOSet) Reindex() error {
+	db := u.Blockchain.Database
+
+	if err := u.DeleteByPrefix(utxoPrefix); err != nil {
+		return err
+	}
+
+	UTXO, err := u.Blockchain.FindUTXO()
+	if err != nil {
+		return err
+	}
+
+	batch := db.NewBatch()
+	pending := 0
+	for txId, outs := range UTXO {
+		key, err := hex.DecodeString(txId)
+		if err != nil {
+			return err
+		}
+		key = prefixedKey(utxoPrefix, key)
+		if err := batch.Put(key, outs.Serialize()); err != nil {
+			return err
+		}
+		if pending++; pending == deleteBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			pending = 0
+		}
+	}
+	return batch.Write()
+}
+
+// Update - это функция, которая применяет к индексу транзакции нового блока.
+func (u *UTXOSet) Update(block *Block) error {
+	batch := u.Blockchain.Database.NewBatch()
+	if err := updateUTXO(batch, block); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// prefixedKey - это функция, которая склеивает префикс и ключ.
+func prefixedKey(prefix, key []byte) []byte {
+	return append(append([]byte{}, prefix...), key...)
+}
+
+// updateUTXO - это функция, которая добавляет в пакет изменения индекса от транзакций блока.
+// Потраченные выходы удаляются, новые выходы добавляются.
+// Потраченные выходы сохраняются под undoPrefix, чтобы revertUTXO мог их вернуть.
+// Так блок и изменения индекса можно записать атомарно.
+func updateUTXO(batch storage.Batch, block *Block) error {
+	var spent []SpentOutput
+
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputes {
+				inID := prefixedKey(utxoPrefix, in.ID)
+				data, err := batch.Get(inID)
+				if err != nil {
+					return err
+				}
+				outs, err := DeserializeOutputs(data)
+				if err != nil {
+					return err
+				}
+
+				spent = append(spent, SpentOutput{in.ID, in.Out, outs.Outputs[in.Out], outs.Coinbase, outs.Height})
+				delete(outs.Outputs, in.Out)
+
+				if len(outs.Outputs) == 0 {
+					if err := batch.Delete(inID); err != nil {
+						return err
+					}
+				} else {
+					if err := batch.Put(inID, outs.Serialize()); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		newOutputs := newTXOutputs(tx.IsCoinbase(), block.Height)
+		for outIdx, out := range tx.Outputs {
+			newOutputs.Outputs[outIdx] = out
+		}
+
+		txID := prefixedKey(utxoPrefix, tx.ID)
+		if err := batch.Put(txID, newOutputs.Serialize()); err != nil {
+			return err
+		}
+	}
+	return batch.Put(prefixedKey(undoPrefix, block.Hash), serializeUndo(spent))
+}
+
+// revertUTXO - это функция, которая добавляет в пакет отмену изменений индекса, сделанных блоком.
+// Транзакции обходятся в обратном порядке: выходы, созданные транзакцией, удаляются,
+// а потраченные ею выходы возвращаются в индекс.
+func revertUTXO(batch storage.Batch, block *Block) error {
+	data, err := batch.Get(prefixedKey(undoPrefix, block.Hash))
+	if err != nil {
+		return err
+	}
+	spent, err := deserializeUndo(data)
+	if err != nil {
+		return err
+	}
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		if err := batch.Delete(prefixedKey(utxoPrefix, tx.ID)); err != nil {
+			return err
+		}
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		// Потраченные выходы лежат в spent в том же порядке, что и входы, поэтому берем их с конца.
+		for j := len(tx.Inputes) - 1; j >= 0; j-- {
+			restored := spent[len(spent)-1]
+			spent = spent[:len(spent)-1]
+
+			key := prefixedKey(utxoPrefix, restored.TxID)
+			outs := newTXOutputs(restored.Coinbase, restored.Height)
+			data, err := batch.Get(key)
+			if err == nil {
+				outs, err = DeserializeOutputs(data)
+			}
+			if err != nil && err != storage.ErrNotFound {
+				return err
+			}
+			outs.Outputs[restored.Index] = restored.Output
+			if err := batch.Put(key, outs.Serialize()); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Delete(prefixedKey(undoPrefix, block.Hash))
+}
+
+// DeleteByPrefix - это функция, которая удаляет все ключи с указанным префиксом.
+// Ключи удаляются пачками, чтобы не превысить размер транзакции хранилища.
+func (u *UTXOSet) DeleteByPrefix(prefix []byte) error {
+	db := u.Blockchain.Database
+	for {
+		keysForDelete := make([][]byte, 0, deleteBatchSize)
+		err := db.Iterate(prefix, func(key, value []byte) error {
+			keysForDelete = append(keysForDelete, key)
+			if len(keysForDelete) == deleteBatchSize {
+				return storage.ErrStopIteration
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(keysForDelete) == 0 {
+			return nil
+		}
+
+		batch := db.NewBatch()
+		for _, key := range keysForDelete {
+			if err := batch.Delete(key); err != nil {
+				return err
+			}
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+	}
+}
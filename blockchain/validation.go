@@ -0,0 +1,376 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Ошибки проверки блоков и транзакций.
+// Проверяющие функции оборачивают их через %w, поэтому причину можно узнать через errors.Is.
+var (
+	ErrNoTransactions  = errors.New("block has no transactions")
+	ErrBadMerkleRoot   = errors.New("merkle root does not match transactions")
+	ErrBadTxID         = errors.New("transaction ID does not match its hash")
+	ErrDuplicateTx     = errors.New("duplicate transaction in block")
+	ErrBadCoinbase     = errors.New("invalid coinbase transaction")
+	ErrBadTransaction  = errors.New("malformed transaction")
+	ErrBadValue        = errors.New("invalid output value")
+	ErrDoubleSpend     = errors.New("output is spent twice")
+	ErrMissingInput    = errors.New("input refers to a spent or unknown output")
+	ErrBadSignature    = errors.New("invalid transaction signature")
+	ErrValueMismatch   = errors.New("outputs exceed inputs")
+	ErrImmatureSpend   = errors.New("coinbase output is not mature")
+	ErrOrphanBlock     = errors.New("previous block is unknown")
+	ErrInvalidParent   = errors.New("previous block is invalid")
+	ErrNotTip          = errors.New("block does not extend the chain tip")
+	ErrBadHeight       = errors.New("block height does not follow previous block")
+	ErrInvalidProof    = errors.New("invalid proof of work")
+	ErrBadBlockVersion = errors.New("unsupported block version")
+	ErrBadBlockHash    = errors.New("block hash does not match its header")
+	ErrBadBits         = errors.New("block difficulty is out of range")
+	ErrTimeTooOld      = errors.New("block time is not after median time past")
+	ErrTimeTooNew      = errors.New("block time is too far in the future")
+	ErrBadGenesis      = errors.New("genesis block does not match the network")
+)
+
+// outpoint - это ссылка на выход: ID транзакции и номер выхода.
+type outpoint struct {
+	txID string
+	out  int
+}
+
+// CheckBlockSanity - это функция, которая проверяет правила, не зависящие от состояния блокчейна:
+// корень Меркла, ID транзакций, положение coinbase, повторы транзакций и входов внутри блока.
+func CheckBlockSanity(block *Block) error {
+	if block.Version != BlockVersion {
+		return fmt.Errorf("%w: %d", ErrBadBlockVersion, block.Version)
+	}
+	// Сложность 0 допустима: ее используют механизмы консенсуса без доказательства работы.
+	if block.Bits < 0 || block.Bits > MaxDifficulty {
+		return fmt.Errorf("%w: %d", ErrBadBits, block.Bits)
+	}
+	if len(block.Transactions) == 0 {
+		return ErrNoTransactions
+	}
+	// Блок мог прийти от другого узла, поэтому пустые транзакции отсекаем до того, как обращаться к их полям.
+	for _, tx := range block.Transactions {
+		if tx == nil {
+			return ErrBadTransaction
+		}
+	}
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return ErrBadMerkleRoot
+	}
+
+	// Каждый блок начинается с coinbase, которая платит майнеру награду и комиссии.
+	if !block.Transactions[0].IsCoinbase() {
+		return fmt.Errorf("%w: block does not start with coinbase", ErrBadCoinbase)
+	}
+	// В coinbase записана высота блока, это делает ее ID уникальным.
+	if height, ok := block.Transactions[0].CoinbaseHeight(); !ok || height != block.Height {
+		return fmt.Errorf("%w: coinbase does not commit to height %d", ErrBadCoinbase, block.Height)
+	}
+
+	seenTXs := make(map[string]bool)
+	spent := make(map[outpoint]bool)
+
+	for i, tx := range block.Transactions {
+		if err := CheckTransactionSanity(tx); err != nil {
+			return err
+		}
+		txID := hex.EncodeToString(tx.ID)
+		if seenTXs[txID] {
+			return fmt.Errorf("%w: %s", ErrDuplicateTx, txID)
+		}
+		seenTXs[txID] = true
+
+		if tx.IsCoinbase() {
+			// Coinbase может быть только первой транзакцией блока.
+			if i != 0 {
+				return fmt.Errorf("%w: coinbase at position %d", ErrBadCoinbase, i)
+			}
+			continue
+		}
+		for _, in := range tx.Inputes {
+			key := outpoint{hex.EncodeToString(in.ID), in.Out}
+			if spent[key] {
+				return fmt.Errorf("%w: %s:%d", ErrDoubleSpend, key.txID, key.out)
+			}
+			spent[key] = true
+		}
+	}
+
+	return nil
+}
+
+// CheckTransactionSanity - это функция, которая проверяет правила транзакции, не зависящие от состояния блокчейна:
+// ID транзакции, наличие входов и выходов, суммы выходов и повторы входов внутри транзакции.
+// Ее вызывают и проверка блока, и мемпул, поэтому транзакция, прошедшая мемпул, не сломает шаблон блока.
+func CheckTransactionSanity(tx *Transaction) error {
+	if tx == nil {
+		return ErrBadTransaction
+	}
+	txID := hex.EncodeToString(tx.ID)
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return fmt.Errorf("%w: %s", ErrBadTxID, txID)
+	}
+
+	if len(tx.Outputs) == 0 {
+		return fmt.Errorf("%w: %s has no outputs", ErrBadTransaction, txID)
+	}
+	outSum := 0
+	for _, out := range tx.Outputs {
+		// Нулевой выход допустим только в coinbase: когда выпуск исчерпан, а комиссий нет.
+		if out.Value < 0 || (out.Value == 0 && !tx.IsCoinbase()) {
+			return fmt.Errorf("%w: %s", ErrBadValue, txID)
+		}
+		// Сравниваем с остатком до MaxMoney, а не складываем, чтобы сумма не переполнилась.
+		if out.Value > MaxMoney-outSum {
+			return fmt.Errorf("%w: %s pays more than %d", ErrBadValue, txID, MaxMoney)
+		}
+		outSum += out.Value
+	}
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	if len(tx.Inputes) == 0 {
+		return fmt.Errorf("%w: %s has no inputs", ErrBadTransaction, txID)
+	}
+	spent := make(map[outpoint]bool)
+	for _, in := range tx.Inputes {
+		// Вход с Out = -1 и пустым ID допустим только в coinbase.
+		if len(in.ID) == 0 || in.Out < 0 {
+			return fmt.Errorf("%w: %s has a coinbase input", ErrBadTransaction, txID)
+		}
+		key := outpoint{hex.EncodeToString(in.ID), in.Out}
+		if spent[key] {
+			return fmt.Errorf("%w: %s:%d", ErrDoubleSpend, key.txID, key.out)
+		}
+		spent[key] = true
+	}
+	return nil
+}
+
+// ValidateBlock - это функция, которая полностью проверяет блок, продолжающий последний блок блокчейна.
+// Она проверяет правила CheckBlockSanity, связь с последним блоком, высоту, печать механизма консенсуса,
+// а также подписи, наличие тратимых выходов и баланс входов и выходов каждой транзакции.
+func (chain *BlockChain) ValidateBlock(block *Block) error {
+	if err := chain.checkBlockHeader(block); err != nil {
+		return err
+	}
+	if !bytes.Equal(block.PrevHash, chain.lastHash) {
+		return fmt.Errorf("%w: %x", ErrNotTip, block.PrevHash)
+	}
+	return chain.validateBlockTransactions(block)
+}
+
+// validateBlockTransactions - это функция, которая проверяет транзакции блока против UTXOSet
+// и то, что coinbase платит не больше награды за высоту блока плюс комиссии.
+func (chain *BlockChain) validateBlockTransactions(block *Block) error {
+	fees, err := chain.ValidateTransactions(block.Transactions)
+	if err != nil {
+		return err
+	}
+
+	allowed := chain.Subsidy(block.Height) + fees
+	if paid := outputsValue(block.Transactions[0]); paid > allowed {
+		return fmt.Errorf("%w: pays %d, subsidy and fees are %d", ErrBadCoinbase, paid, allowed)
+	}
+	return nil
+}
+
+// checkBlockHeader - это функция, которая проверяет блок без учета UTXOSet:
+// правила CheckBlockSanity, известного и действительного родителя, высоту и печать механизма консенсуса.
+// Этих проверок достаточно, чтобы сохранить блок боковой ветки.
+func (chain *BlockChain) checkBlockHeader(block *Block) error {
+	if err := CheckBlockSanity(block); err != nil {
+		return err
+	}
+
+	prev, err := chain.GetBlock(block.PrevHash)
+	if err != nil {
+		return fmt.Errorf("%w: %x", ErrOrphanBlock, block.PrevHash)
+	}
+	if chain.isInvalid(block.PrevHash) {
+		return fmt.Errorf("%w: %x", ErrInvalidParent, block.PrevHash)
+	}
+	if block.Height != prev.Height+1 {
+		return fmt.Errorf("%w: %d after %d", ErrBadHeight, block.Height, prev.Height)
+	}
+
+	median, err := chain.MedianTimePast(&prev)
+	if err != nil {
+		return err
+	}
+	if block.Timestamp <= median {
+		return fmt.Errorf("%w: %d, median %d", ErrTimeTooOld, block.Timestamp, median)
+	}
+	if limit := time.Now().Unix() + MaxFutureBlockTime; block.Timestamp > limit {
+		return fmt.Errorf("%w: %d, limit %d", ErrTimeTooNew, block.Timestamp, limit)
+	}
+	return chain.Engine.VerifyHeader(chain, block)
+}
+
+// CheckOrphanHeader - это функция, которая проверяет блок, родителя которого у узла еще нет:
+// правила CheckBlockSanity, время блока и печать механизма консенсуса, см. Consensus.VerifySeal.
+// Прошедший проверку блок можно отложить до прихода родителя: подделать его так же дорого, как настоящий.
+func (chain *BlockChain) CheckOrphanHeader(block *Block) error {
+	if err := CheckBlockSanity(block); err != nil {
+		return err
+	}
+	if block.Height == 0 {
+		return fmt.Errorf("%w: %d after %x", ErrBadHeight, block.Height, block.PrevHash)
+	}
+	if limit := time.Now().Unix() + MaxFutureBlockTime; block.Timestamp > limit {
+		return fmt.Errorf("%w: %d, limit %d", ErrTimeTooNew, block.Timestamp, limit)
+	}
+	return chain.Engine.VerifySeal(chain, block)
+}
+
+// ValidateTransactions - это функция, которая проверяет транзакции так, как будто они попадут в следующий блок.
+// Тратить можно выходы из UTXOSet и выходы более ранних транзакций этого же списка.
+// Она возвращает сумму комиссий: комиссия транзакции - это разница между входами и выходами.
+func (chain *BlockChain) ValidateTransactions(txs []*Transaction) (int, error) {
+	validator, err := chain.newTxValidator()
+	if err != nil {
+		return 0, err
+	}
+	fees := 0
+	for _, tx := range txs {
+		fee, err := validator.add(tx)
+		if err != nil {
+			return 0, err
+		}
+		if fee > MaxMoney-fees {
+			return 0, fmt.Errorf("%w: fees exceed %d", ErrBadValue, MaxMoney)
+		}
+		fees += fee
+	}
+	return fees, nil
+}
+
+// txValidator - это проверка списка транзакций, в который транзакции добавляются по одной.
+// Так шаблон блока может пропустить транзакцию, которая больше не проходит проверку, и продолжить со следующей.
+type txValidator struct {
+	utxo UTXOSet
+	// blockTXs - это транзакции списка, которые уже проверены.
+	blockTXs map[string]Transaction
+	spent    map[outpoint]bool
+	// spendHeight - это высота блока, в который попадут транзакции.
+	spendHeight int
+	// maturity - это сколько блоков должно пройти, прежде чем выходы coinbase можно потратить.
+	maturity int
+}
+
+// newTxValidator - это функция, которая создает проверку транзакций для следующего блока.
+func (chain *BlockChain) newTxValidator() (*txValidator, error) {
+	bestHeight, err := chain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+	return &txValidator{
+		utxo:        UTXOSet{Blockchain: chain},
+		blockTXs:    make(map[string]Transaction),
+		spent:       make(map[outpoint]bool),
+		spendHeight: bestHeight + 1,
+		maturity:    chain.Params.CoinbaseMaturity,
+	}, nil
+}
+
+// add - это функция, которая проверяет транзакцию после уже добавленных и возвращает ее комиссию.
+// Недействительная транзакция не меняет состояние проверки.
+func (v *txValidator) add(tx *Transaction) (int, error) {
+	// Суммы входов и выходов сравниваются ниже, поэтому выходы должны быть в границах MaxMoney.
+	if err := CheckTransactionSanity(tx); err != nil {
+		return 0, err
+	}
+	txID := hex.EncodeToString(tx.ID)
+	if _, ok := v.blockTXs[txID]; ok {
+		return 0, fmt.Errorf("%w: %s", ErrDuplicateTx, txID)
+	}
+	// Транзакция с таким же ID, у которой остались непотраченные выходы, перезаписала бы их в UTXOSet.
+	exists, err := v.utxo.HasTransaction(tx.ID)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, fmt.Errorf("%w: %s is already in the chain", ErrDuplicateTx, txID)
+	}
+	if tx.IsCoinbase() {
+		v.blockTXs[txID] = *tx
+		return 0, nil
+	}
+
+	// prevOuts - это выходы, которые тратят входы, по ним проверяются подписи.
+	prevOuts := make([]TXOutput, 0, len(tx.Inputes))
+	// spent - это выходы, которые тратит сама транзакция, они попадут в v.spent только если она действительна.
+	spent := make(map[outpoint]bool)
+	inSum := 0
+
+	for _, in := range tx.Inputes {
+		inID := hex.EncodeToString(in.ID)
+		key := outpoint{inID, in.Out}
+		if v.spent[key] || spent[key] {
+			return 0, fmt.Errorf("%w: %s:%d", ErrDoubleSpend, inID, in.Out)
+		}
+		spent[key] = true
+
+		var out TXOutput
+		if prevTX, ok := v.blockTXs[inID]; ok {
+			if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+				return 0, fmt.Errorf("%w: %s:%d", ErrMissingInput, inID, in.Out)
+			}
+			if prevTX.IsCoinbase() && v.maturity > 0 {
+				return 0, fmt.Errorf("%w: %s:%d", ErrImmatureSpend, inID, in.Out)
+			}
+			out = prevTX.Outputs[in.Out]
+		} else {
+			outs, found, err := v.utxo.FindOutputs(in.ID)
+			if err != nil {
+				return 0, err
+			}
+			if found {
+				out, found = outs.Outputs[in.Out]
+			}
+			if !found {
+				return 0, fmt.Errorf("%w: %s:%d", ErrMissingInput, inID, in.Out)
+			}
+			if !outs.IsMature(v.spendHeight, v.maturity) {
+				return 0, fmt.Errorf("%w: %s:%d", ErrImmatureSpend, inID, in.Out)
+			}
+		}
+		if out.Value < 0 || out.Value > MaxMoney-inSum {
+			return 0, fmt.Errorf("%w: %s spends more than %d", ErrBadValue, txID, MaxMoney)
+		}
+		prevOuts = append(prevOuts, out)
+		inSum += out.Value
+	}
+
+	if !tx.VerifyOutputs(prevOuts) {
+		return 0, fmt.Errorf("%w: %s", ErrBadSignature, txID)
+	}
+
+	outSum := outputsValue(tx)
+	if outSum > inSum {
+		return 0, fmt.Errorf("%w: %s spends %d, has %d", ErrValueMismatch, txID, outSum, inSum)
+	}
+
+	for key := range spent {
+		v.spent[key] = true
+	}
+	v.blockTXs[txID] = *tx
+	return inSum - outSum, nil
+}
+
+// outputsValue - это функция, которая считает сумму выходов транзакции.
+func outputsValue(tx *Transaction) int {
+	sum := 0
+	for _, out := range tx.Outputs {
+		sum += out.Value
+	}
+	return sum
+}
@@ -1,184 +1,617 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"runtime"
+	"os/signal"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+	"github.com/fenix1851/golang-blockchain/network"
 	"github.com/fenix1851/golang-blockchain/wallet"
 )
 
-type CommandLine struct{}
+// signersFile - это файл в папке данных со списком подписантов доказательства полномочий:
+// по одному публичному ключу в hex на строку. Если файла нет, используется доказательство работы.
+const signersFile = "signers"
+
+// Коды выхода, которые возвращает Run.
+const (
+	ExitOK = iota
+	// ExitError - это любая ошибка, для которой нет отдельного кода.
+	ExitError
+	// ExitUsage - это неверные команда или флаги.
+	ExitUsage
+	// ExitBadAddress - это неверный адрес или адрес другой сети.
+	ExitBadAddress
+	// ExitChainState - это блокчейн уже создан или еще не создан.
+	ExitChainState
+	// ExitInsufficientFunds - это недостаточно средств для перевода.
+	ExitInsufficientFunds
+	// ExitRejected - это транзакция или блок не прошли проверку.
+	ExitRejected
+)
+
+// Ошибки командной строки.
+var (
+	errUsage    = errors.New("invalid usage")
+	errNoWallet = errors.New("no wallet for address")
+)
+
+// ExitCode - это функция, которая возвращает код выхода для ошибки команды. Ошибки проверки
+// транзакции и мемпула дают ExitRejected.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, errUsage):
+		return ExitUsage
+	case errors.Is(err, blockchain.ErrBadAddress), errors.Is(err, wallet.ErrBadAddress), errors.Is(err, wallet.ErrWrongNetwork),
+		errors.Is(err, errNoWallet):
+		return ExitBadAddress
+	case errors.Is(err, blockchain.ErrChainExists), errors.Is(err, blockchain.ErrNoChain):
+		return ExitChainState
+	case errors.Is(err, blockchain.ErrInsufficientFunds):
+		return ExitInsufficientFunds
+	case errors.Is(err, blockchain.ErrBadTransaction), errors.Is(err, blockchain.ErrMempoolExists),
+		errors.Is(err, blockchain.ErrMempoolConflict), errors.Is(err, blockchain.ErrMempoolFull),
+		errors.Is(err, blockchain.ErrFeeNotFit), errors.Is(err, network.ErrTxNotAccepted),
+		errors.Is(err, blockchain.ErrBadSignature), errors.Is(err, blockchain.ErrDoubleSpend),
+		errors.Is(err, blockchain.ErrMissingInput), errors.Is(err, blockchain.ErrValueMismatch),
+		errors.Is(err, blockchain.ErrImmatureSpend), errors.Is(err, blockchain.ErrBadValue),
+		errors.Is(err, blockchain.ErrBadTxID), errors.Is(err, blockchain.ErrDuplicateTx):
+		return ExitRejected
+	default:
+		return ExitError
+	}
+}
+
+// CommandLine - это интерфейс командной строки. config - это настройки узла из глобальных флагов.
+type CommandLine struct {
+	config *config.Config
+}
 
 func (cli *CommandLine) printUsage() {
-	fmt.Println("Usage:")
+	fmt.Println("Usage: [-datadir DIR] [-network NETWORK] COMMAND")
+	fmt.Println(" -datadir DIR - keep the blockchain, wallets and other node files in DIR")
+	fmt.Println(" -network NETWORK - run on NETWORK, one of: " + strings.Join(networkNames(), ", "))
 	fmt.Println(" getbalance -address ADDRESS - get balance for ADDRESS")
-	fmt.Println(" createblockchain -address ADDRESS - create a blockchain and send genesis block reward to ADDRESS")
+	fmt.Println(" createblockchain - create a blockchain starting with the genesis block of the network")
 	fmt.Println(" printchain - print all the blocks of the blockchain")
-	fmt.Println(" send -from FROM -to TO -amount AMOUNT - send AMOUNT of coins from FROM address to TO")
+	fmt.Println(" send -from FROM -to TO -amount AMOUNT [-fee FEE] [-feerate RATE] [-mine | -node ADDR] - send AMOUNT of coins from FROM address to TO paying FEE plus RATE per byte, -mine mines a block right away, -node submits the transaction to the running node at ADDR")
+	fmt.Println(" mine -address ADDRESS - mine a block with the pending transactions from the mempool and pay the reward and fees to ADDRESS")
 	fmt.Println(" createwallet - creates a new wallet")
 	fmt.Println(" listaddresses - lists the addresses in our wallet file")
+	fmt.Println(" reindexutxo - rebuilds the UTXO set")
+	fmt.Println(" startnode [-port PORT] [-connect ADDR,...] [-seeds ADDR,...] [-outbound N] - run a network node on PORT, connect to the nodes at ADDR, keep N connections to discovered nodes and download their blocks")
+	fmt.Println("Blocks are sealed with proof of authority if " + signersFile + " in the data directory lists signer public keys, one hex key per line.")
 }
 
-func (cli *CommandLine) validateArgs() {
-	if len(os.Args) < 2 {
+// networkNames - возвращает имена сетей, которые можно выбрать флагом -network.
+func networkNames() []string {
+	var names []string
+	for name := range config.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (cli *CommandLine) validateArgs(args []string) error {
+	if len(args) < 1 {
 		cli.printUsage()
-		runtime.Goexit()
+		return errUsage
+	}
+	return nil
+}
+
+// validateAddress - проверяет, что адрес правильный и принадлежит выбранной сети.
+func (cli *CommandLine) validateAddress(address string) error {
+	if _, err := wallet.PubKeyHashForNetwork(address, cli.config.Params.AddressVersion); err != nil {
+		return fmt.Errorf("%w: %s: %v", blockchain.ErrBadAddress, address, err)
+	}
+	return nil
+}
+
+// engine - возвращает механизм консенсуса, которым CLI создает и проверяет блоки.
+// Если есть файл подписантов, это доказательство полномочий с подписантами из кошелька, иначе доказательство работы.
+func (cli *CommandLine) engine() (blockchain.Consensus, error) {
+	content, err := os.ReadFile(cli.config.Path(signersFile))
+	if os.IsNotExist(err) {
+		return blockchain.NewPoWEngine(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var signers [][]byte
+	for _, line := range strings.Fields(string(content)) {
+		pubKey, err := hex.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad signer key %q: %w", signersFile, line, err)
+		}
+		signers = append(signers, pubKey)
+	}
+
+	// Подписываем блоки теми кошельками, публичные ключи которых есть в списке подписантов.
+	var local []*wallet.Wallet
+	wallets, err := wallet.CreateWallets(cli.config)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range wallets.Wallets {
+		for _, signer := range signers {
+			if bytes.Equal(w.PublicKey, signer) {
+				local = append(local, w)
+			}
+		}
+	}
+
+	return blockchain.NewPoAEngine(signers, local...)
+}
+
+// openChain - открывает существующий блокчейн с механизмом консенсуса из engine.
+func (cli *CommandLine) openChain() (*blockchain.BlockChain, error) {
+	engine, err := cli.engine()
+	if err != nil {
+		return nil, err
+	}
+	chain, err := blockchain.ContinueBlockChain(cli.config, engine)
+	if err != nil {
+		return nil, err
 	}
+	chain.Logf = logf
+	return chain, nil
+}
+
+// logf - печатает сообщение блокчейна отдельной строкой.
+func logf(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
 }
 
-func (cli *CommandLine) printChain() {
-	chain := blockchain.ContinueBlockChain("")
+func (cli *CommandLine) printChain() error {
+	chain, err := cli.openChain()
+	if err != nil {
+		return err
+	}
 	defer chain.Database.Close()
 	iter := chain.Iterator()
 
 	for {
-		block := iter.Next()
+		block, err := iter.Next()
+		if err != nil {
+			return err
+		}
 
+		fmt.Printf("Height: %d\n", block.Height)
+		fmt.Printf("Version: %d\n", block.Version)
+		fmt.Printf("Timestamp: %s\n", time.Unix(block.Timestamp, 0).Format(time.RFC3339))
 		fmt.Printf("Previous hash: %x\n", block.PrevHash)
 		fmt.Printf("Hash: %x\n", block.Hash)
+		fmt.Printf("Merkle root: %x\n", block.MerkleRoot)
+		fmt.Printf("Bits: %d\n", block.Bits)
+		fmt.Printf("Nonce: %d\n", block.Nonce)
 
-		pow := blockchain.NewProof(block)
-		fmt.Printf("PoW: %s\n", strconv.FormatBool(pow.Validate()))
+		fmt.Printf("Seal: %s\n", strconv.FormatBool(chain.CheckSeal(block) == nil))
+		fmt.Println()
 
 		if len(block.PrevHash) == 0 {
-			break
+			return nil
 		}
 	}
 }
 
-// createBlockchain - создает новый блокчейн и сохраняет его в базу данных.
-func (cli *CommandLine) createBlockchain(address string) {
-	chain := blockchain.InitBlockChain(address)
+// createBlockchain - создает новый блокчейн с генезис-блоком сети и сохраняет его в базу данных.
+func (cli *CommandLine) createBlockchain() error {
+	engine, err := cli.engine()
+	if err != nil {
+		return err
+	}
+	chain, err := blockchain.InitBlockChain(cli.config, engine)
+	if err != nil {
+		return err
+	}
 	chain.Database.Close()
 	fmt.Println("Finished!")
+	return nil
 }
 
 // getBalance - выводит баланс для указанного адреса.
-func (cli *CommandLine) getBalance(address string) {
-	chain := blockchain.ContinueBlockChain(address)
+func (cli *CommandLine) getBalance(address string) error {
+	pubKeyHash, err := wallet.PubKeyHashForNetwork(address, cli.config.Params.AddressVersion)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", blockchain.ErrBadAddress, address, err)
+	}
+	chain, err := cli.openChain()
+	if err != nil {
+		return err
+	}
 	defer chain.Database.Close()
 
-	balance := 0
-	UTXOs := chain.FindUTXO(address)
-
-	for _, out := range UTXOs {
-		balance += out.Value
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	balance, immature, err := UTXOSet.Balance(pubKeyHash)
+	if err != nil {
+		return err
 	}
+
 	fmt.Printf("Balance of %s is %d \n", address, balance)
+	if immature > 0 {
+		fmt.Printf("Immature balance of %s is %d \n", address, immature)
+	}
+	return nil
 }
 
-func (cli *CommandLine) listaddresses() {
-	wallets, _ := wallet.CreateWallets()
+// reindexUTXO - заново строит индекс непотраченных выходов по всему блокчейну.
+func (cli *CommandLine) reindexUTXO() error {
+	chain, err := cli.openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	if err := UTXOSet.Reindex(); err != nil {
+		return err
+	}
+
+	count, err := UTXOSet.CountTransactions()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+	return nil
+}
+
+func (cli *CommandLine) listaddresses() error {
+	wallets, err := wallet.CreateWallets(cli.config)
+	if err != nil {
+		return err
+	}
 	addresses := wallets.GetAllAddresses()
 	if len(addresses) == 0 {
 		fmt.Println("There are no addresses in the wallet file!")
-		return
+		return nil
 	}
 	for _, address := range addresses {
 		fmt.Println(address)
 	}
+	return nil
 }
 
-func (cli *CommandLine) createWallet() {
-	wallets, _ := wallet.CreateWallets()
-	address := wallets.AddWallet()
-	wallets.SaveFile()
+func (cli *CommandLine) createWallet() error {
+	wallets, err := wallet.CreateWallets(cli.config)
+	if err != nil {
+		return err
+	}
+	address, err := wallets.AddWallet()
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
 	fmt.Printf("New address is: %s\n", address)
+	fmt.Printf("Public key is: %x\n", wallets.GetWallet(address).PublicKey)
+	return nil
 }
 
 // send - отправляет токены с одного адреса на другой.
-func (cli *CommandLine) send(from, to string, amount int) {
-	chain := blockchain.ContinueBlockChain(from)
+// Транзакция попадает в мемпул и ждет майнинга, если не указан mineNow.
+func (cli *CommandLine) send(from, to string, amount int, fee blockchain.FeePolicy, mineNow bool) error {
+	if err := cli.validateAddress(from); err != nil {
+		return err
+	}
+	if err := cli.validateAddress(to); err != nil {
+		return err
+	}
+	chain, err := cli.openChain()
+	if err != nil {
+		return err
+	}
 	defer chain.Database.Close()
 
-	tx := blockchain.NewTransaction(from, to, amount, chain)
-	chain.AddBlock([]*blockchain.Transaction{tx})
+	wallets, err := wallet.CreateWallets(cli.config)
+	if err != nil {
+		return err
+	}
+	w := wallets.GetWallet(from)
+	if w == nil {
+		return fmt.Errorf("%w %s", errNoWallet, from)
+	}
+
+	pool, err := blockchain.NewMempool(chain)
+	if err != nil {
+		return err
+	}
+	// Выходы, уже потраченные транзакциями мемпула, не выбираются, иначе вторая отправка конфликтовала бы с первой.
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain, Mempool: pool}
+	tx, err := blockchain.NewTransaction(w, to, amount, fee, &UTXOSet)
+	if err != nil {
+		return err
+	}
+	if err := pool.Add(tx); err != nil {
+		return fmt.Errorf("transaction rejected: %w", err)
+	}
+	fmt.Printf("Transaction %x added to the mempool\n", tx.ID)
+	if mineNow {
+		if err := cli.mineBlock(chain, pool, from); err != nil {
+			return err
+		}
+	}
 	fmt.Println("Success!")
+	return nil
 }
 
-func (cli *CommandLine) Run() {
-	cli.validateArgs()
+// sendToNode - отправляет токены через запущенный узел node: пока узел работает, база данных блокчейна занята им.
+// Выходы кошелька берутся у узла, транзакция подписывается здесь и попадает в мемпул узла, а он объявляет ее сети.
+func (cli *CommandLine) sendToNode(from, to string, amount int, fee blockchain.FeePolicy, node string) error {
+	if err := cli.validateAddress(from); err != nil {
+		return err
+	}
+	if err := cli.validateAddress(to); err != nil {
+		return err
+	}
+	wallets, err := wallet.CreateWallets(cli.config)
+	if err != nil {
+		return err
+	}
+	w := wallets.GetWallet(from)
+	if w == nil {
+		return fmt.Errorf("%w %s", errNoWallet, from)
+	}
 
-	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
-	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
-	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
-	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
-	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
-	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	client, err := network.Dial(cli.config.Params, node)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
 
-	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
-	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
-	sendFrom := sendCmd.String("from", "", "Source wallet address")
-	sendTo := sendCmd.String("to", "", "Destination wallet address")
-	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	outs, err := client.SpendableOutputs(wallet.PublicKeyHash(w.PublicKey))
+	if err != nil {
+		return err
+	}
+	tx, err := blockchain.NewTransactionFromOutputs(w, to, amount, fee, cli.config.Params, outs)
+	if err != nil {
+		return err
+	}
+	if err := client.SubmitTransaction(tx); err != nil {
+		return fmt.Errorf("transaction rejected: %w", err)
+	}
+	fmt.Printf("Transaction %x added to the mempool of %s\n", tx.ID, node)
+	fmt.Println("Success!")
+	return nil
+}
 
-	switch os.Args[1] {
-	case "getbalance":
-		err := getBalanceCmd.Parse(os.Args[2:])
-		Handle(err)
-	case "createblockchain":
-		err := createBlockchainCmd.Parse(os.Args[2:])
-		Handle(err)
-	case "printchain":
-		err := printChainCmd.Parse(os.Args[2:])
-		Handle(err)
-	case "send":
-		err := sendCmd.Parse(os.Args[2:])
-		Handle(err)
-	case "createwallet":
-		err := createWalletCmd.Parse(os.Args[2:])
-		Handle(err)
-	case "listaddresses":
-		err := listAddressesCmd.Parse(os.Args[2:])
-		Handle(err)
-	default:
-		cli.printUsage()
-		runtime.Goexit()
+// mine - майнит блок из транзакций мемпула, комиссии получает miner.
+func (cli *CommandLine) mine(miner string) error {
+	if err := cli.validateAddress(miner); err != nil {
+		return err
 	}
+	chain, err := cli.openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Database.Close()
 
-	if getBalanceCmd.Parsed() {
-		if *getBalanceAddress == "" {
-			getBalanceCmd.Usage()
-			runtime.Goexit()
+	pool, err := blockchain.NewMempool(chain)
+	if err != nil {
+		return err
+	}
+	return cli.mineBlock(chain, pool, miner)
+}
+
+// mineBlock - собирает шаблон блока из мемпула, майнит его и убирает попавшие в блок транзакции.
+func (cli *CommandLine) mineBlock(chain *blockchain.BlockChain, pool *blockchain.Mempool, miner string) error {
+	txs, err := pool.BlockTemplate(blockchain.MaxBlockTxSize)
+	if err != nil {
+		return err
+	}
+
+	// Майнинг можно прервать по Ctrl+C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// Скорость майнинга есть только у доказательства работы.
+	if pow, ok := chain.Engine.(*blockchain.PoWEngine); ok {
+		pow.Miner.OnHashRate = func(hashesPerSecond float64) {
+			fmt.Printf("\rMining at %.0f H/s", hashesPerSecond)
 		}
-		cli.getBalance(*getBalanceAddress)
 	}
 
-	if createBlockchainCmd.Parsed() {
-		if *createBlockchainAddress == "" {
-			createBlockchainCmd.Usage()
-			runtime.Goexit()
+	block, err := chain.MineBlockContext(ctx, miner, txs)
+	fmt.Println()
+	if err != nil {
+		return fmt.Errorf("mining failed: %w", err)
+	}
+	if err := pool.RemoveBlock(block); err != nil {
+		return err
+	}
+	fmt.Printf("Mined block %x with %d transactions\n", block.Hash, len(block.Transactions))
+	return nil
+}
+
+// splitAddrs - разбирает список адресов через запятую.
+func splitAddrs(list string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
 		}
-		cli.createBlockchain(*createBlockchainAddress)
 	}
-	if createWalletCmd.Parsed() {
-		cli.createWallet()
+	return addrs
+}
+
+// startNode - запускает узел сети на порту port, подключается к узлам peers и работает до Ctrl+C.
+// Кроме peers, узел поддерживает outbound исходящих соединений с узлами из адресной книги и seed-узлами.
+// Узел без блокчейна скачивает его у участников, начиная с генезис-блока.
+func (cli *CommandLine) startNode(port, outbound int, peers []string) error {
+	engine, err := cli.engine()
+	if err != nil {
+		return err
 	}
-	if listAddressesCmd.Parsed() {
-		cli.listaddresses()
+	chain, err := blockchain.OpenBlockChain(cli.config, engine)
+	if err != nil {
+		return err
 	}
+	defer chain.Database.Close()
+	chain.Logf = logf
 
-	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
-			sendCmd.Usage()
-			runtime.Goexit()
+	server := network.NewServer(cli.config, chain, fmt.Sprintf(":%d", port))
+	server.TargetOutbound = outbound
+	server.Logf = logf
+	server.OnProgress = func(height, target int) {
+		if target <= 0 {
+			return
 		}
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		fmt.Printf("\rSyncing blocks: %d/%d", height, target)
+		if height >= target {
+			fmt.Println()
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := server.Start(); err != nil {
+		return err
 	}
+	defer server.Stop()
+	fmt.Printf("Node is listening on %s, network %s\n", server.Addr(), cli.config.Params.Name)
+	// Транзакции, отправленные командой send, пока узел был остановлен, узел объявит участникам.
+	if count := server.Mempool().Count(); count > 0 {
+		fmt.Printf("Relaying %d mempool transactions\n", count)
+	}
+	fmt.Printf("Address book has %d nodes\n", server.AddrBook().Len())
 
-	if printChainCmd.Parsed() {
-		cli.printChain()
+	for _, addr := range peers {
+		if _, err := server.Connect(addr); err != nil {
+			fmt.Printf("Could not connect to %s: %v\n", addr, err)
+		}
 	}
+	<-ctx.Done()
+	fmt.Println("Stopping the node")
+	return nil
+}
 
+// Run - разбирает аргументы, выполняет команду и возвращает код выхода.
+// Ошибка команды печатается в stderr, а ее вид определяет код выхода, см. ExitCode.
+func (cli *CommandLine) Run() int {
+	err := cli.run(os.Args[1:])
+	if err != nil && err != errUsage {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+	return ExitCode(err)
 }
 
-func Handle(err error) {
+// run - выполняет команду из args.
+func (cli *CommandLine) run(args []string) error {
+	// Глобальные флаги идут до команды и задают папку данных и сеть.
+	globalFlags := flag.NewFlagSet("global", flag.ContinueOnError)
+	globalFlags.Usage = cli.printUsage
+	dataDir := globalFlags.String("datadir", "", "The directory for the blockchain, wallets and other node files")
+	networkName := globalFlags.String("network", config.MainNet.Name, "The network to run on")
+	if err := globalFlags.Parse(args); err != nil {
+		return errUsage
+	}
+	args = globalFlags.Args()
+	if err := cli.validateArgs(args); err != nil {
+		return err
+	}
+
+	params, err := config.Network(*networkName)
 	if err != nil {
-		fmt.Println(err.Error())
-		runtime.Goexit()
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	cli.config = config.New(*dataDir, params)
+
+	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ContinueOnError)
+	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ContinueOnError)
+	sendCmd := flag.NewFlagSet("send", flag.ContinueOnError)
+	printChainCmd := flag.NewFlagSet("printchain", flag.ContinueOnError)
+	createWalletCmd := flag.NewFlagSet("createwallet", flag.ContinueOnError)
+	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ContinueOnError)
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ContinueOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ContinueOnError)
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ContinueOnError)
+
+	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
+	sendFrom := sendCmd.String("from", "", "Source wallet address")
+	sendTo := sendCmd.String("to", "", "Destination wallet address")
+	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendMine := sendCmd.Bool("mine", false, "Mine a block right away")
+	sendFee := sendCmd.Int("fee", 0, "Fixed fee paid to the miner")
+	sendFeeRate := sendCmd.Int("feerate", 0, "Fee per byte of the transaction paid to the miner")
+	sendNode := sendCmd.String("node", "", "Address of a running node to submit the transaction to")
+	mineAddress := mineCmd.String("address", "", "The address to pay the block reward and fees to")
+	startNodePort := startNodeCmd.Int("port", cli.config.Params.DefaultPort, "The TCP port to listen on")
+	startNodeConnect := startNodeCmd.String("connect", "", "Comma-separated addresses of the nodes to connect to")
+	startNodeSeeds := startNodeCmd.String("seeds", strings.Join(cli.config.Seeds, ","), "Comma-separated addresses of the nodes to ask for other nodes while the address book is empty")
+	startNodeOutbound := startNodeCmd.Int("outbound", network.DefaultTargetOutbound, "The number of outbound connections to keep, 0 to connect only to -connect")
+
+	commands := map[string]*flag.FlagSet{
+		getBalanceCmd.Name():       getBalanceCmd,
+		createBlockchainCmd.Name(): createBlockchainCmd,
+		sendCmd.Name():             sendCmd,
+		printChainCmd.Name():       printChainCmd,
+		createWalletCmd.Name():     createWalletCmd,
+		listAddressesCmd.Name():    listAddressesCmd,
+		reindexUTXOCmd.Name():      reindexUTXOCmd,
+		mineCmd.Name():             mineCmd,
+		startNodeCmd.Name():        startNodeCmd,
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		cli.printUsage()
+		return errUsage
+	}
+	if err := cmd.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	switch cmd {
+	case getBalanceCmd:
+		if *getBalanceAddress == "" {
+			getBalanceCmd.Usage()
+			return errUsage
+		}
+		return cli.getBalance(*getBalanceAddress)
+	case createBlockchainCmd:
+		return cli.createBlockchain()
+	case createWalletCmd:
+		return cli.createWallet()
+	case listAddressesCmd:
+		return cli.listaddresses()
+	case reindexUTXOCmd:
+		return cli.reindexUTXO()
+	case mineCmd:
+		if *mineAddress == "" {
+			mineCmd.Usage()
+			return errUsage
+		}
+		return cli.mine(*mineAddress)
+	case startNodeCmd:
+		if *startNodePort < 0 || *startNodePort > 65535 || *startNodeOutbound < 0 {
+			startNodeCmd.Usage()
+			return errUsage
+		}
+		cli.config.Seeds = splitAddrs(*startNodeSeeds)
+		return cli.startNode(*startNodePort, *startNodeOutbound, splitAddrs(*startNodeConnect))
+	case sendCmd:
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFee < 0 || *sendFeeRate < 0 || (*sendMine && *sendNode != "") {
+			sendCmd.Usage()
+			return errUsage
+		}
+		fee := blockchain.FeePolicy{Fixed: *sendFee, PerByte: *sendFeeRate}
+		if *sendNode != "" {
+			return cli.sendToNode(*sendFrom, *sendTo, *sendAmount, fee, *sendNode)
+		}
+		return cli.send(*sendFrom, *sendTo, *sendAmount, fee, *sendMine)
+	default:
+		return cli.printChain()
 	}
 }
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// DefaultDataDir - это папка с данными узла основной сети, если она не задана флагом -datadir.
+const DefaultDataDir = "./tmp"
+
+// ChainParams - это параметры сети. Узлы с разными параметрами не могут работать с одним блокчейном.
+type ChainParams struct {
+	// Name - это имя сети, по нему сеть выбирается флагом -network.
+	Name string
+	// GenesisData - это сообщение в coinbase-транзакции генезис-блока.
+	GenesisData string
+	// GenesisTime - это время генезис-блока в секундах Unix.
+	GenesisTime int64
+	// GenesisNonce - это nonce генезис-блока, при котором его хэш удовлетворяет сложности Difficulty.
+	GenesisNonce int
+	// GenesisHash - это хэш генезис-блока в шестнадцатеричном виде.
+	// Узел не создает и не принимает блокчейн с другим генезис-блоком.
+	GenesisHash string
+	// Reward - это награда за блок до первого уменьшения вдвое.
+	Reward int
+	// Difficulty - это сложность генезис-блока в битах.
+	Difficulty int
+	// AddressVersion - это байт версии в начале адресов сети.
+	// По нему адрес одной сети отличается от адреса другой.
+	AddressVersion byte
+	// Magic - это байты в начале каждого сетевого сообщения, по ним узел отбрасывает сообщения чужой сети.
+	Magic [4]byte
+	// CoinbaseMaturity - это сколько блоков должно пройти, прежде чем выходы coinbase можно потратить.
+	// Пока coinbase не созрела, ее может отменить переход на другую ветку.
+	CoinbaseMaturity int
+	// NoRetargeting - это запрет пересчета сложности: все блоки имеют сложность генезис-блока.
+	NoRetargeting bool
+	// DefaultPort - это TCP-порт, который узел слушает, если порт не задан флагом -port.
+	DefaultPort int
+	// Seeds - это адреса узлов, к которым узел подключается, пока его адресная книга пуста.
+	Seeds []string
+}
+
+// MainNet - это параметры основной сети.
+var MainNet = ChainParams{
+	Name:             "mainnet",
+	GenesisData:      "First Transaction from Genesis",
+	GenesisTime:      1735689600,
+	GenesisNonce:     50853,
+	GenesisHash:      "00003007ad13db742e47ca38384d99d98a1ea3a0e05ad8caf63689c014d11f64",
+	Reward:           100,
+	Difficulty:       18,
+	AddressVersion:   0x00,
+	Magic:            [4]byte{0xf9, 0xbe, 0xb4, 0xd9},
+	CoinbaseMaturity: 100,
+	DefaultPort:      3000,
+}
+
+// TestNet - это параметры тестовой сети: монеты в ней ничего не стоят, а сложность ниже, чем в основной сети.
+var TestNet = ChainParams{
+	Name:             "testnet",
+	GenesisData:      "First Transaction from Testnet Genesis",
+	GenesisTime:      1735689600,
+	GenesisNonce:     2119,
+	GenesisHash:      "000fa314fe64025b8a13b5e3dfd441590b4a45fe6b1b48fe75de9ec4d3845f0f",
+	Reward:           100,
+	Difficulty:       12,
+	AddressVersion:   0x6f,
+	Magic:            [4]byte{0x0b, 0x11, 0x09, 0x07},
+	CoinbaseMaturity: 100,
+	DefaultPort:      13000,
+}
+
+// RegTest - это параметры локальной сети для тестов: блоки майнятся мгновенно, сложность не пересчитывается.
+var RegTest = ChainParams{
+	Name:             "regtest",
+	GenesisData:      "First Transaction from Regtest Genesis",
+	GenesisTime:      1735689600,
+	GenesisNonce:     0,
+	GenesisHash:      "256d62574480bc0bb4445d10d53df5d869a26d9fa418ce1abe810f171447871c",
+	Reward:           100,
+	Difficulty:       1,
+	AddressVersion:   0x3c,
+	Magic:            [4]byte{0xfa, 0xbf, 0xb5, 0xda},
+	CoinbaseMaturity: 100,
+	NoRetargeting:    true,
+	DefaultPort:      23000,
+}
+
+// Networks - это сети, которые можно выбрать по имени.
+var Networks = map[string]*ChainParams{
+	MainNet.Name: &MainNet,
+	TestNet.Name: &TestNet,
+	RegTest.Name: &RegTest,
+}
+
+// Network - это функция, которая возвращает параметры сети по ее имени.
+func Network(name string) (*ChainParams, error) {
+	params, ok := Networks[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown network %q", name)
+	}
+	return params, nil
+}
+
+// Config - это настройки узла: где лежат его данные и в какой сети он работает.
+type Config struct {
+	// DataDir - это папка, в которой лежат база данных блокчейна и остальные файлы узла.
+	DataDir string
+	// WalletFile - это путь к файлу кошельков.
+	WalletFile string
+	// PeersFile - это путь к адресной книге узлов сети.
+	PeersFile string
+	// BansFile - это путь к списку заблокированных узлов сети.
+	BansFile string
+	// Seeds - это адреса узлов для первого подключения. По умолчанию это Seeds параметров сети.
+	Seeds []string
+	// Params - это параметры сети.
+	Params *ChainParams
+}
+
+// New - это функция, которая создает настройки узла сети params с данными в dataDir.
+// Если dataDir пустая, данные основной сети лежат в DefaultDataDir, а других сетей - в ее подпапке с именем сети,
+// поэтому узлы разных сетей не мешают друг другу.
+func New(dataDir string, params *ChainParams) *Config {
+	if dataDir == "" {
+		dataDir = DefaultDataDir
+		if params.Name != MainNet.Name {
+			dataDir = filepath.Join(dataDir, params.Name)
+		}
+	}
+	return &Config{
+		DataDir:    dataDir,
+		WalletFile: filepath.Join(dataDir, "wallets.data"),
+		PeersFile:  filepath.Join(dataDir, "peers.data"),
+		BansFile:   filepath.Join(dataDir, "bans.data"),
+		Seeds:      append([]string{}, params.Seeds...),
+		Params:     params,
+	}
+}
+
+// Default - это функция, которая возвращает настройки узла основной сети с папкой данных по умолчанию.
+func Default() *Config {
+	return New("", &MainNet)
+}
+
+// BlocksDir - это функция, которая возвращает папку базы данных блокчейна.
+func (c *Config) BlocksDir() string {
+	return filepath.Join(c.DataDir, "blocks")
+}
+
+// Path - это функция, которая возвращает путь к файлу name в папке данных.
+func (c *Config) Path(name string) string {
+	return filepath.Join(c.DataDir, name)
+}
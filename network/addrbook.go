@@ -0,0 +1,256 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAddrs - это сколько адресов хранит адресная книга. Когда она заполнена, забываются давно не виденные.
+	maxAddrs = 5000
+	// addrMaxAge - это через сколько адрес, который никто не видел, удаляется из адресной книги.
+	addrMaxAge = 30 * 24 * time.Hour
+	// addrMaxFailures - это после скольких неудачных подключений подряд адрес удаляется из адресной книги.
+	addrMaxFailures = 10
+	// addrRetryDelay - это сколько узел ждет после неудачного подключения, прежде чем повторить его.
+	// С каждой следующей неудачей задержка растет.
+	addrRetryDelay = time.Minute
+	// addrMaxFuture - это насколько время последнего контакта из сообщения addr может быть впереди наших часов.
+	addrMaxFuture = 10 * time.Minute
+)
+
+// KnownAddr - это адрес узла из адресной книги.
+type KnownAddr struct {
+	// Addr - это адрес, на котором узел принимает соединения, в виде host:port.
+	Addr string
+	// LastSeen - это время последнего известного контакта с узлом в секундах Unix.
+	LastSeen int64
+	// LastAttempt - это время последней попытки подключиться к узлу в секундах Unix.
+	LastAttempt int64
+	// Failures - это число неудачных подключений подряд.
+	Failures int
+}
+
+// AddrBook - это адресная книга: узлы сети, о которых узнал узел, и время последнего контакта с ними.
+// Книга хранится в файле, поэтому после перезапуска узлу не нужны seed-узлы.
+type AddrBook struct {
+	file  string
+	mu    sync.Mutex
+	addrs map[string]*KnownAddr
+	dirty bool
+}
+
+// NewAddrBook - это функция, которая создает пустую адресную книгу, хранящуюся в файле file.
+func NewAddrBook(file string) *AddrBook {
+	return &AddrBook{file: file, addrs: make(map[string]*KnownAddr)}
+}
+
+// Load - это функция, которая читает адресную книгу из файла. Если файла нет, книга остается пустой.
+func (b *AddrBook) Load() error {
+	content, err := os.ReadFile(b.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var addrs map[string]*KnownAddr
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&addrs); err != nil {
+		return fmt.Errorf("address book %s: %v", b.file, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addrs = make(map[string]*KnownAddr)
+	for _, addr := range addrs {
+		if addr != nil && validAddr(addr.Addr) && !addr.expired(time.Now()) {
+			b.addrs[addr.Addr] = addr
+		}
+	}
+	return nil
+}
+
+// Save - это функция, которая записывает адресную книгу в файл, если она изменилась.
+// Файл заменяется целиком, поэтому прерванная запись не портит старую книгу.
+func (b *AddrBook) Save() error {
+	b.mu.Lock()
+	if !b.dirty {
+		b.mu.Unlock()
+		return nil
+	}
+	var content bytes.Buffer
+	err := gob.NewEncoder(&content).Encode(b.addrs)
+	b.dirty = false
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.file), 0755); err != nil {
+		return err
+	}
+	tmp := b.file + ".tmp"
+	if err := os.WriteFile(tmp, content.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.file)
+}
+
+// Add - это функция, которая добавляет адрес в книгу или обновляет время последнего контакта с ним.
+// Возвращает false, если адрес неверный.
+func (b *AddrBook) Add(addr string, lastSeen time.Time) bool {
+	if !validAddr(addr) {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	known, ok := b.addrs[addr]
+	if !ok {
+		if len(b.addrs) >= maxAddrs {
+			b.evictOldest()
+		}
+		known = &KnownAddr{Addr: addr}
+		b.addrs[addr] = known
+	}
+	if lastSeen.Unix() > known.LastSeen {
+		known.LastSeen = lastSeen.Unix()
+	}
+	b.dirty = true
+	return true
+}
+
+// Connected - это функция, которая отмечает успешное подключение к адресу.
+func (b *AddrBook) Connected(addr string) {
+	if !b.Add(addr, time.Now()) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addrs[addr].Failures = 0
+}
+
+// Attempt - это функция, которая отмечает попытку подключиться к адресу.
+func (b *AddrBook) Attempt(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if known, ok := b.addrs[addr]; ok {
+		known.LastAttempt = time.Now().Unix()
+		b.dirty = true
+	}
+}
+
+// Failed - это функция, которая отмечает неудачное подключение к адресу.
+// После addrMaxFailures неудач подряд адрес удаляется.
+func (b *AddrBook) Failed(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	known, ok := b.addrs[addr]
+	if !ok {
+		return
+	}
+	known.Failures++
+	if known.Failures >= addrMaxFailures {
+		delete(b.addrs, addr)
+	}
+	b.dirty = true
+}
+
+// Remove - это функция, которая удаляет адрес из книги.
+func (b *AddrBook) Remove(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.addrs[addr]; ok {
+		delete(b.addrs, addr)
+		b.dirty = true
+	}
+}
+
+// Len - это функция, которая возвращает число адресов в книге.
+func (b *AddrBook) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.addrs)
+}
+
+// Addresses - это функция, которая возвращает до max адресов, от недавно виденных к давно виденным.
+func (b *AddrBook) Addresses(max int) []KnownAddr {
+	b.mu.Lock()
+	addrs := make([]KnownAddr, 0, len(b.addrs))
+	for _, known := range b.addrs {
+		addrs = append(addrs, *known)
+	}
+	b.mu.Unlock()
+
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].LastSeen != addrs[j].LastSeen {
+			return addrs[i].LastSeen > addrs[j].LastSeen
+		}
+		return addrs[i].Addr < addrs[j].Addr
+	})
+	if len(addrs) > max {
+		addrs = addrs[:max]
+	}
+	return addrs
+}
+
+// Candidates - это функция, которая выбирает до max адресов для исходящих подключений:
+// адреса не из skip, к которым можно повторить подключение, от недавно виденных к давно виденным.
+func (b *AddrBook) Candidates(max int, skip map[string]bool) []string {
+	now := time.Now()
+	var candidates []string
+	for _, known := range b.Addresses(maxAddrs) {
+		if len(candidates) >= max {
+			break
+		}
+		if skip[known.Addr] || !known.retryReady(now) {
+			continue
+		}
+		candidates = append(candidates, known.Addr)
+	}
+	return candidates
+}
+
+// evictOldest - это функция, которая удаляет давно не виденный адрес. Вызывается под блокировкой.
+func (b *AddrBook) evictOldest() {
+	var oldest *KnownAddr
+	for _, known := range b.addrs {
+		if oldest == nil || known.LastSeen < oldest.LastSeen {
+			oldest = known
+		}
+	}
+	if oldest != nil {
+		delete(b.addrs, oldest.Addr)
+	}
+}
+
+// expired - это функция, которая проверяет, что с узлом слишком давно никто не связывался.
+func (a *KnownAddr) expired(now time.Time) bool {
+	return a.LastSeen > 0 && now.Sub(time.Unix(a.LastSeen, 0)) > addrMaxAge
+}
+
+// retryReady - это функция, которая проверяет, прошла ли задержка после неудачных подключений к адресу.
+func (a *KnownAddr) retryReady(now time.Time) bool {
+	if a.Failures == 0 {
+		return true
+	}
+	delay := time.Duration(a.Failures) * addrRetryDelay
+	return now.Sub(time.Unix(a.LastAttempt, 0)) >= delay
+}
+
+// validAddr - это функция, которая проверяет, что адрес имеет вид host:port с непустым хостом и портом больше 0.
+func validAddr(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
@@ -0,0 +1,274 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+)
+
+const (
+	// BanThreshold - это штраф, набрав который участник отключается и блокируется.
+	BanThreshold = 100
+	// DefaultBanDuration - это на сколько узел блокирует участника по умолчанию.
+	DefaultBanDuration = 24 * time.Hour
+	// scoreMemory - это сколько узел помнит штраф адреса после его последнего нарушения.
+	// Штраф переживает переподключение, иначе участник мог бы сбрасывать его, соединяясь заново.
+	scoreMemory = time.Hour
+)
+
+// Штрафы за нарушения участника.
+const (
+	// scoreInvalidBlock - это штраф за недействительный блок: его нельзя прислать по ошибке.
+	scoreInvalidBlock = BanThreshold
+	// scoreMalformed - это штраф за сообщение, которое не разбирается.
+	scoreMalformed = 50
+	// scoreProtocol - это штраф за нарушение протокола, например слишком длинный список или повторный version.
+	scoreProtocol = 20
+	// scoreInvalidTx - это штраф за недействительную транзакцию.
+	scoreInvalidTx = 10
+)
+
+// Ошибки нарушений участника. По ним misbehaviourScore определяет штраф.
+var (
+	ErrInvalidBlock = errors.New("invalid block")
+	ErrInvalidTx    = errors.New("invalid transaction")
+	ErrBanned       = errors.New("peer is banned")
+)
+
+// misbehaviourScore - это функция, которая возвращает штраф участника за ошибку err.
+// 0 означает, что ошибка не нарушение, например обрыв соединения.
+func misbehaviourScore(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidBlock):
+		return scoreInvalidBlock
+	case errors.Is(err, ErrBadPayload), errors.Is(err, ErrBadChecksum), errors.Is(err, ErrBadMagic),
+		errors.Is(err, ErrPayloadTooLarge):
+		return scoreMalformed
+	case errors.Is(err, ErrTooManyItems), errors.Is(err, ErrHandshake):
+		return scoreProtocol
+	case errors.Is(err, ErrInvalidTx):
+		return scoreInvalidTx
+	}
+	return 0
+}
+
+// invalidTx - это функция, которая проверяет, что транзакция отклонена из-за нарушения правил, а не потому,
+// что узел еще не знает ее входы или в мемпуле уже есть конфликтующая транзакция.
+func invalidTx(err error) bool {
+	for _, rule := range []error{
+		blockchain.ErrBadTransaction, blockchain.ErrBadTxID, blockchain.ErrBadValue,
+		blockchain.ErrBadSignature, blockchain.ErrValueMismatch, blockchain.ErrDoubleSpend,
+	} {
+		if errors.Is(err, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidBlock - это функция, которая проверяет, что блок отклонен из-за нарушения правил консенсуса,
+// а не из-за ошибки хранилища узла.
+func invalidBlock(err error) bool {
+	for _, rule := range []error{
+		blockchain.ErrNoTransactions, blockchain.ErrBadMerkleRoot, blockchain.ErrBadTxID, blockchain.ErrDuplicateTx,
+		blockchain.ErrBadCoinbase, blockchain.ErrBadTransaction, blockchain.ErrBadValue, blockchain.ErrDoubleSpend,
+		blockchain.ErrMissingInput, blockchain.ErrBadSignature, blockchain.ErrValueMismatch,
+		blockchain.ErrImmatureSpend, blockchain.ErrInvalidParent, blockchain.ErrBadHeight, blockchain.ErrTimeTooOld,
+		blockchain.ErrInvalidProof, blockchain.ErrBadBlockVersion, blockchain.ErrBadBlockHash, blockchain.ErrBadBits,
+		blockchain.ErrUnauthorizedSigner, blockchain.ErrSignerOutOfTurn, blockchain.ErrBadSealSignature, blockchain.ErrBadGenesis,
+	} {
+		if errors.Is(err, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostScore - это штраф адреса за нарушения всех его соединений и время последнего нарушения.
+type hostScore struct {
+	score   int
+	updated time.Time
+}
+
+// addHostScore - это функция, которая добавляет адресу host штраф n и возвращает итоговый штраф.
+// Штраф, не пополнявшийся дольше scoreMemory, забывается.
+func (s *Server) addHostScore(host string, n int) int {
+	s.scoreMu.Lock()
+	defer s.scoreMu.Unlock()
+	now := time.Now()
+	for other, hs := range s.scores {
+		if now.Sub(hs.updated) >= scoreMemory {
+			delete(s.scores, other)
+		}
+	}
+	hs := s.scores[host]
+	hs.score += n
+	hs.updated = now
+	s.scores[host] = hs
+	return hs.score
+}
+
+// misbehave - это функция, которая добавляет участнику и его адресу штраф за нарушение reason.
+// Адрес, набравший BanThreshold, блокируется на BanDuration, а участник отключается, тогда функция возвращает true.
+// Участник, нарушивший протокол еще при рукопожатии, тоже получает штраф, хотя в список участников не попал.
+func (s *Server) misbehave(peer *Peer, score int, reason error) bool {
+	peer.addScore(score)
+	total := s.addHostScore(peer.host(), score)
+	s.logf("Misbehaviour of %s (+%d, total %d): %v", peer, score, total, reason)
+	if total < BanThreshold {
+		return false
+	}
+
+	until := time.Now().Add(s.BanDuration)
+	s.bans.Ban(peer.host(), until)
+	s.scoreMu.Lock()
+	delete(s.scores, peer.host())
+	s.scoreMu.Unlock()
+	if err := s.bans.Save(); err != nil {
+		s.logf("Ban list: %v", err)
+	}
+	s.logf("Banned %s until %s", peer.host(), until.Format(time.RFC3339))
+	s.removePeer(peer, fmt.Errorf("%w: misbehaviour score %d", ErrBanned, total))
+	// removePeer возвращает адрес участника в адресную книгу, поэтому удаляем его после отключения.
+	s.addrs.Remove(peer.bookAddr())
+	return true
+}
+
+// BanList - это список заблокированных узлов: IP-адрес и время окончания блокировки.
+// Список хранится в файле, поэтому блокировка переживает перезапуск узла.
+type BanList struct {
+	file  string
+	mu    sync.Mutex
+	bans  map[string]int64
+	dirty bool
+}
+
+// NewBanList - это функция, которая создает пустой список блокировок, хранящийся в файле file.
+func NewBanList(file string) *BanList {
+	return &BanList{file: file, bans: make(map[string]int64)}
+}
+
+// Load - это функция, которая читает список блокировок из файла. Если файла нет, список остается пустым.
+func (l *BanList) Load() error {
+	content, err := os.ReadFile(l.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var bans map[string]int64
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&bans); err != nil {
+		return fmt.Errorf("ban list %s: %v", l.file, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bans = make(map[string]int64)
+	now := time.Now().Unix()
+	for host, until := range bans {
+		if until > now {
+			l.bans[host] = until
+		}
+	}
+	return nil
+}
+
+// Save - это функция, которая записывает список блокировок в файл, если он изменился.
+func (l *BanList) Save() error {
+	l.mu.Lock()
+	if !l.dirty {
+		l.mu.Unlock()
+		return nil
+	}
+	var content bytes.Buffer
+	err := gob.NewEncoder(&content).Encode(l.bans)
+	l.dirty = false
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.file), 0755); err != nil {
+		return err
+	}
+	tmp := l.file + ".tmp"
+	if err := os.WriteFile(tmp, content.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.file)
+}
+
+// Ban - это функция, которая блокирует узел host до времени until.
+func (l *BanList) Ban(host string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.Unix() > l.bans[host] {
+		l.bans[host] = until.Unix()
+		l.dirty = true
+	}
+}
+
+// Unban - это функция, которая снимает блокировку узла host.
+func (l *BanList) Unban(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.bans[host]; ok {
+		delete(l.bans, host)
+		l.dirty = true
+	}
+}
+
+// IsBanned - это функция, которая проверяет, заблокирован ли сейчас узел host. Истекшие блокировки удаляются.
+func (l *BanList) IsBanned(host string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until, ok := l.bans[host]
+	if !ok {
+		return false
+	}
+	if until <= time.Now().Unix() {
+		delete(l.bans, host)
+		l.dirty = true
+		return false
+	}
+	return true
+}
+
+// Hosts - это функция, которая возвращает заблокированные узлы, отсортированные по адресу.
+func (l *BanList) Hosts() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now().Unix()
+	hosts := make([]string, 0, len(l.bans))
+	for host, until := range l.bans {
+		if until > now {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// BanList - это функция, которая возвращает список блокировок узла.
+func (s *Server) BanList() *BanList {
+	return s.bans
+}
+
+// hostOf - это функция, которая возвращает хост адреса host:port или сам адрес, если порта в нем нет.
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,156 @@
+package network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+)
+
+// clientTimeout - это сколько Client ждет ответа узла на запрос.
+const clientTimeout = 30 * time.Second
+
+// ErrTxNotAccepted - это ошибка транзакции, которую узел не добавил в мемпул. Причину узел пишет в свой журнал.
+var ErrTxNotAccepted = errors.New("transaction was not accepted by the node")
+
+// Client - это соединение с узлом сети без своей копии блокчейна. Через него командная строка
+// получает выходы кошелька и отправляет транзакции, пока база данных занята запущенным узлом.
+type Client struct {
+	peer *Peer
+}
+
+// Dial - это функция, которая подключается к узлу addr сети params и проводит с ним рукопожатие.
+// Клиент объявляет пустой блокчейн и не принимает соединения, поэтому узел не скачивает у него блоки
+// и не записывает его в адресную книгу.
+func Dial(params *config.ChainParams, addr string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{peer: newPeer(conn, params.Magic, false)}
+	c.peer.Addr = addr
+	if err := c.handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// handshake - это функция, которая обменивается с узлом сообщениями version и verack.
+func (c *Client) handshake() error {
+	var nonce [8]byte
+	rand.Read(nonce[:])
+	version := Version{
+		Version:    ProtocolVersion,
+		BestHeight: -1,
+		Nonce:      binary.BigEndian.Uint64(nonce[:]),
+		Timestamp:  time.Now().Unix(),
+	}
+	if err := c.peer.Send(CmdVersion, version); err != nil {
+		return err
+	}
+
+	var theirs Version
+	if err := c.receive(CmdVersion, &theirs, handshakeTimeout); err != nil {
+		return fmt.Errorf("%w: %v", ErrHandshake, err)
+	}
+	if theirs.Version < MinProtocolVersion {
+		return fmt.Errorf("%w: %d", ErrProtocolVersion, theirs.Version)
+	}
+	c.peer.Version = theirs.Version
+	c.peer.SetBestHeight(theirs.BestHeight)
+
+	if err := c.peer.Send(CmdVerack, Verack{}); err != nil {
+		return err
+	}
+	if err := c.receive(CmdVerack, &Verack{}, handshakeTimeout); err != nil {
+		return fmt.Errorf("%w: %v", ErrHandshake, err)
+	}
+	return nil
+}
+
+// receive - это функция, которая ждет от узла сообщение command и декодирует его в v.
+// Остальные сообщения, например объявления блоков и транзакций, пропускаются.
+func (c *Client) receive(command string, v interface{}, timeout time.Duration) error {
+	c.peer.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer c.peer.conn.SetReadDeadline(time.Time{})
+	for {
+		m, err := c.peer.receive()
+		if err != nil {
+			return err
+		}
+		if m.Command == command {
+			return m.Decode(v)
+		}
+	}
+}
+
+// BestHeight - это функция, которая возвращает высоту блокчейна узла из его сообщения version.
+func (c *Client) BestHeight() int {
+	return c.peer.BestHeight()
+}
+
+// SpendableOutputs - это функция, которая запрашивает у узла выходы, которые pubKeyHash может потратить.
+// Узел отдает не больше MaxUTXOItems выходов.
+func (c *Client) SpendableOutputs(pubKeyHash []byte) ([]blockchain.SpendableOutput, error) {
+	if err := c.peer.Send(CmdGetUTXOs, GetUTXOs{pubKeyHash}); err != nil {
+		return nil, err
+	}
+	var reply UTXOs
+	if err := c.receive(CmdUTXOs, &reply, clientTimeout); err != nil {
+		return nil, err
+	}
+	return reply.Outputs, nil
+}
+
+// SubmitTransaction - это функция, которая отправляет транзакцию узлу и проверяет, что она попала в его мемпул.
+// Узел обрабатывает сообщения участника по порядку, поэтому на getdata после tx он ответит
+// самой транзакцией, если принял ее, или notfound. Иначе возвращается ErrTxNotAccepted.
+func (c *Client) SubmitTransaction(tx *blockchain.Transaction) error {
+	if err := c.peer.Send(CmdTx, Tx{tx.Serialize()}); err != nil {
+		return err
+	}
+	if err := c.peer.Send(CmdGetData, GetData{InvTx, [][]byte{tx.ID}}); err != nil {
+		return err
+	}
+
+	c.peer.conn.SetReadDeadline(time.Now().Add(clientTimeout))
+	defer c.peer.conn.SetReadDeadline(time.Time{})
+	for {
+		m, err := c.peer.receive()
+		if err != nil {
+			return fmt.Errorf("%w: %x: %v", ErrTxNotAccepted, tx.ID, err)
+		}
+		switch m.Command {
+		case CmdTx:
+			var reply Tx
+			if err := m.Decode(&reply); err != nil {
+				return err
+			}
+			if pooled, err := blockchain.DeserializeTransaction(reply.Data); err == nil && bytes.Equal(pooled.ID, tx.ID) {
+				return nil
+			}
+		case CmdNotFound:
+			var reply NotFound
+			if err := m.Decode(&reply); err != nil {
+				return err
+			}
+			for _, txID := range reply.Items {
+				if bytes.Equal(txID, tx.ID) {
+					return fmt.Errorf("%w: %x", ErrTxNotAccepted, tx.ID)
+				}
+			}
+		}
+	}
+}
+
+// Close - это функция, которая закрывает соединение с узлом.
+func (c *Client) Close() error {
+	return c.peer.Close()
+}
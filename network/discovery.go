@@ -0,0 +1,157 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultTargetOutbound - это сколько исходящих соединений узел поддерживает по умолчанию.
+	DefaultTargetOutbound = 8
+	// connectInterval - это как часто узел проверяет число исходящих соединений и сохраняет адресную книгу.
+	connectInterval = 5 * time.Second
+)
+
+// connLoop - это функция, которая поддерживает TargetOutbound исходящих соединений и сохраняет адресную книгу.
+// Кроме периодической проверки, она просыпается, когда узел узнает новые адреса.
+func (s *Server) connLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(connectInterval)
+	defer ticker.Stop()
+	for {
+		s.fillOutbound()
+		if err := s.addrs.Save(); err != nil {
+			s.logf("Address book: %v", err)
+		}
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		case <-s.connectNow:
+		}
+	}
+}
+
+// wakeConnLoop - это функция, которая просит connLoop проверить исходящие соединения, не дожидаясь таймера.
+func (s *Server) wakeConnLoop() {
+	select {
+	case s.connectNow <- struct{}{}:
+	default:
+	}
+}
+
+// fillOutbound - это функция, которая подключается к адресам из адресной книги, если исходящих соединений
+// меньше TargetOutbound. Если исходящих соединений нет и в книге нечего выбрать, узел подключается к seed-узлам.
+func (s *Server) fillOutbound() {
+	s.mu.Lock()
+	if s.closed || s.TargetOutbound <= 0 {
+		s.mu.Unlock()
+		return
+	}
+	skip := make(map[string]bool)
+	outbound := 0
+	for _, peer := range s.peers {
+		skip[peer.Addr] = true
+		if peer.ListenAddr != "" {
+			skip[peer.ListenAddr] = true
+		}
+		if !peer.Inbound {
+			outbound++
+		}
+	}
+	for addr := range s.dialing {
+		skip[addr] = true
+	}
+	need := s.TargetOutbound - outbound - len(s.dialing)
+	s.mu.Unlock()
+	if need <= 0 {
+		return
+	}
+
+	addrs := s.addrs.Candidates(need, skip)
+	if len(addrs) == 0 && outbound == 0 {
+		for _, seed := range s.cfg.Seeds {
+			if len(addrs) < need && !skip[seed] {
+				addrs = append(addrs, seed)
+			}
+		}
+	}
+	for _, addr := range addrs {
+		s.mu.Lock()
+		s.dialing[addr] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func(addr string) {
+			defer s.wg.Done()
+			s.dial(addr)
+		}(addr)
+	}
+}
+
+// dial - это функция, которая подключается к адресу addr и отмечает результат в адресной книге.
+func (s *Server) dial(addr string) {
+	s.addrs.Attempt(addr)
+	_, err := s.Connect(addr)
+
+	s.mu.Lock()
+	delete(s.dialing, addr)
+	s.mu.Unlock()
+
+	switch {
+	case err == nil, errors.Is(err, ErrDuplicatePeer), errors.Is(err, ErrServerClosed):
+	case errors.Is(err, ErrSelfConnect), errors.Is(err, ErrBanned):
+		// Это наш собственный адрес, который нам сообщили участники, или заблокированный узел.
+		s.addrs.Remove(addr)
+	default:
+		s.addrs.Failed(addr)
+		s.logf("Could not connect to %s: %v", addr, err)
+	}
+}
+
+// handleGetAddr - это обработчик getaddr: узел отвечает адресами из своей адресной книги.
+func (s *Server) handleGetAddr(peer *Peer, m *Message) error {
+	var request GetAddr
+	if err := m.Decode(&request); err != nil {
+		return err
+	}
+	var addrs []NetAddr
+	for _, known := range s.addrs.Addresses(MaxAddrItems) {
+		// Участнику не нужен его собственный адрес.
+		if known.Addr == peer.bookAddr() {
+			continue
+		}
+		addrs = append(addrs, NetAddr{known.Addr, known.LastSeen})
+	}
+	return peer.Send(CmdAddr, Addr{addrs})
+}
+
+// handleAddr - это обработчик addr: узел добавляет адреса в адресную книгу, кроме заблокированных.
+// Время последнего контакта из будущего заменяется текущим, чтобы участник не мог поднять свои адреса в списке.
+func (s *Server) handleAddr(peer *Peer, m *Message) error {
+	var msg Addr
+	if err := m.Decode(&msg); err != nil {
+		return err
+	}
+	if len(msg.Addrs) > MaxAddrItems {
+		return fmt.Errorf("%w: %s with %d addresses", ErrTooManyItems, m.Command, len(msg.Addrs))
+	}
+	now := time.Now()
+	for _, addr := range msg.Addrs {
+		if s.bans.IsBanned(hostOf(addr.Addr)) {
+			continue
+		}
+		lastSeen := time.Unix(addr.LastSeen, 0)
+		if lastSeen.After(now.Add(addrMaxFuture)) {
+			lastSeen = now
+		}
+		s.addrs.Add(addr.Addr, lastSeen)
+	}
+	s.wakeConnLoop()
+	return nil
+}
+
+// AddrBook - это функция, которая возвращает адресную книгу узла.
+func (s *Server) AddrBook() *AddrBook {
+	return s.addrs
+}
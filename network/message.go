@@ -0,0 +1,230 @@
+package network
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+)
+
+const (
+	// ProtocolVersion - это версия сетевого протокола узла.
+	ProtocolVersion = 1
+	// MinProtocolVersion - это самая старая версия протокола, с которой узел еще работает.
+	MinProtocolVersion = 1
+	// commandLength - это длина поля команды в заголовке сообщения.
+	commandLength = 12
+	// headerLength - это длина заголовка: magic, команда, длина и контрольная сумма данных.
+	headerLength = 4 + commandLength + 4 + 4
+	// MaxPayloadSize - это максимальный размер данных одного сообщения.
+	MaxPayloadSize = 32 << 20
+)
+
+// Команды сетевых сообщений.
+const (
+	CmdVersion   = "version"
+	CmdVerack    = "verack"
+	CmdGetBlocks = "getblocks"
+	CmdInv       = "inv"
+	CmdGetData   = "getdata"
+	CmdBlock     = "block"
+	CmdNotFound  = "notfound"
+	CmdTx        = "tx"
+	CmdMempool   = "mempool"
+	CmdGetAddr   = "getaddr"
+	CmdAddr      = "addr"
+	CmdGetUTXOs  = "getutxos"
+	CmdUTXOs     = "utxos"
+)
+
+// Типы объектов в сообщениях inv, getdata и notfound.
+const (
+	InvBlock = "block"
+	InvTx    = "tx"
+)
+
+// MaxInvItems - это максимальное число хэшей в одном сообщении inv, getdata или notfound.
+const MaxInvItems = 500
+
+// MaxAddrItems - это максимальное число адресов в одном сообщении addr.
+const MaxAddrItems = 1000
+
+// MaxUTXOItems - это максимальное число выходов в одном сообщении utxos.
+const MaxUTXOItems = 1000
+
+// Ошибки разбора сообщений.
+var (
+	ErrBadMagic        = errors.New("message is from another network")
+	ErrPayloadTooLarge = errors.New("message payload is too large")
+	ErrBadChecksum     = errors.New("message checksum mismatch")
+	ErrBadPayload      = errors.New("malformed message payload")
+)
+
+// Message - это сетевое сообщение: команда и ее данные в кодировке gob.
+type Message struct {
+	Command string
+	Payload []byte
+}
+
+// Version - это первое сообщение, которым узлы обмениваются после соединения.
+type Version struct {
+	// Version - это версия протокола отправителя.
+	Version int
+	// BestHeight - это высота последнего блока отправителя.
+	BestHeight int
+	// ListenPort - это порт, на котором отправитель принимает соединения, или 0.
+	ListenPort int
+	// Nonce - это случайное число узла, по нему узел узнает соединение с самим собой.
+	Nonce uint64
+	// Timestamp - это время отправителя в секундах Unix.
+	Timestamp int64
+}
+
+// Verack - это подтверждение, что сообщение version принято.
+type Verack struct{}
+
+// GetBlocks - это запрос хэшей блоков, которые идут после нашего последнего общего с участником блока.
+type GetBlocks struct {
+	// Locator - это локатор блоков отправителя, см. blockchain.BlockChain.BlockLocator.
+	Locator [][]byte
+}
+
+// Inv - это список объектов, которые есть у отправителя. Ответ на getblocks или объявление нового объекта.
+type Inv struct {
+	Type  string
+	Items [][]byte
+}
+
+// GetData - это запрос объектов по их хэшам.
+type GetData struct {
+	Type  string
+	Items [][]byte
+}
+
+// NotFound - это ответ на getdata для объектов, которых у отправителя нет.
+type NotFound struct {
+	Type  string
+	Items [][]byte
+}
+
+// Block - это блок, сериализованный blockchain.Block.Serialize.
+type Block struct {
+	Data []byte
+}
+
+// Tx - это транзакция, сериализованная blockchain.Transaction.Serialize.
+type Tx struct {
+	Data []byte
+}
+
+// MempoolRequest - это запрос ID всех транзакций мемпула участника, ответ приходит сообщениями inv.
+type MempoolRequest struct{}
+
+// GetAddr - это запрос адресов узлов, которые знает участник.
+type GetAddr struct{}
+
+// NetAddr - это адрес узла сети и время последнего контакта с ним.
+type NetAddr struct {
+	// Addr - это адрес, на котором узел принимает соединения, в виде host:port.
+	Addr string
+	// LastSeen - это время последнего контакта с узлом в секундах Unix.
+	LastSeen int64
+}
+
+// Addr - это адреса узлов сети, ответ на getaddr.
+type Addr struct {
+	Addrs []NetAddr
+}
+
+// GetUTXOs - это запрос выходов, которые хэш публичного ключа может потратить в следующем блоке.
+// Его посылает Client, которому нужно собрать транзакцию без своей копии блокчейна.
+type GetUTXOs struct {
+	PubKeyHash []byte
+}
+
+// UTXOs - это ответ на getutxos: не больше MaxUTXOItems выходов, не потраченных ни блокчейном, ни мемпулом узла.
+type UTXOs struct {
+	Outputs []blockchain.SpendableOutput
+}
+
+// checksum - это функция, которая возвращает первые 4 байта двойного SHA-256 данных.
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// EncodeMessage - это функция, которая кодирует данные сообщения в gob.
+func EncodeMessage(command string, data interface{}) (*Message, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(data); err != nil {
+		return nil, err
+	}
+	return &Message{command, buffer.Bytes()}, nil
+}
+
+// Decode - это функция, которая декодирует данные сообщения в v.
+// Данные приходят от участника и могут быть любыми, поэтому и ошибка, и паника декодера
+// возвращаются как ErrBadPayload.
+func (m *Message) Decode(v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %s: %v", ErrBadPayload, m.Command, r)
+		}
+	}()
+	if err := gob.NewDecoder(bytes.NewReader(m.Payload)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrBadPayload, m.Command, err)
+	}
+	return nil
+}
+
+// WriteMessage - это функция, которая записывает сообщение с заголовком сети magic.
+func WriteMessage(w io.Writer, magic [4]byte, m *Message) error {
+	if len(m.Command) > commandLength {
+		return fmt.Errorf("command %q is too long", m.Command)
+	}
+	if len(m.Payload) > MaxPayloadSize {
+		return ErrPayloadTooLarge
+	}
+	header := make([]byte, headerLength)
+	copy(header, magic[:])
+	copy(header[4:], m.Command)
+	binary.BigEndian.PutUint32(header[4+commandLength:], uint32(len(m.Payload)))
+	copy(header[8+commandLength:], checksum(m.Payload))
+
+	if _, err := w.Write(append(header, m.Payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage - это функция, которая читает сообщение и проверяет его заголовок.
+// Сообщение другой сети, слишком большое или с неверной контрольной суммой не принимается.
+func ReadMessage(r io.Reader, magic [4]byte) (*Message, error) {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], magic[:]) {
+		return nil, fmt.Errorf("%w: magic %x", ErrBadMagic, header[:4])
+	}
+	command := string(bytes.TrimRight(header[4:4+commandLength], "\x00"))
+	length := binary.BigEndian.Uint32(header[4+commandLength:])
+	if length > MaxPayloadSize {
+		return nil, fmt.Errorf("%w: %s: %d bytes", ErrPayloadTooLarge, command, length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[8+commandLength:], checksum(payload)) {
+		return nil, fmt.Errorf("%w: %s", ErrBadChecksum, command)
+	}
+	return &Message{command, payload}, nil
+}
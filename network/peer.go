@@ -0,0 +1,149 @@
+package network
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// writeTimeout - это сколько узел ждет отправки одного сообщения, прежде чем считать соединение потерянным.
+const writeTimeout = 30 * time.Second
+
+// Peer - это соединенный с узлом участник сети.
+type Peer struct {
+	conn  net.Conn
+	magic [4]byte
+	// Addr - это адрес соединения: адрес, по которому узел подключился, или адрес входящего соединения.
+	Addr string
+	// Inbound - это признак входящего соединения.
+	Inbound bool
+	// Version - это версия протокола участника из его сообщения version.
+	Version int
+	// ListenAddr - это адрес, на котором участник принимает соединения, или пустая строка.
+	ListenAddr string
+	// Connected - это время установки соединения.
+	Connected time.Time
+
+	sendMu     sync.Mutex
+	mu         sync.Mutex
+	bestHeight int
+	// knownTxs - это транзакции, о которых участник уже знает: их ему не объявляем.
+	knownTxs *idCache
+	// score - это штраф участника за нарушения. Набрав BanThreshold, участник блокируется.
+	score int
+}
+
+// newPeer - это функция, которая создает участника для соединения conn сети magic.
+func newPeer(conn net.Conn, magic [4]byte, inbound bool) *Peer {
+	return &Peer{
+		conn:      conn,
+		magic:     magic,
+		Addr:      conn.RemoteAddr().String(),
+		Inbound:   inbound,
+		Connected: time.Now(),
+		knownTxs:  newIDCache(maxKnownTxs),
+	}
+}
+
+// Send - это функция, которая кодирует данные и отправляет участнику сообщение command.
+// Сообщения одному участнику можно отправлять из разных горутин.
+func (p *Peer) Send(command string, data interface{}) error {
+	m, err := EncodeMessage(command, data)
+	if err != nil {
+		return err
+	}
+	return p.send(m)
+}
+
+// send - это функция, которая отправляет участнику готовое сообщение.
+func (p *Peer) send(m *Message) error {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return WriteMessage(p.conn, p.magic, m)
+}
+
+// receive - это функция, которая читает следующее сообщение участника.
+func (p *Peer) receive() (*Message, error) {
+	return ReadMessage(p.conn, p.magic)
+}
+
+// BestHeight - это функция, которая возвращает последнюю известную высоту блокчейна участника.
+func (p *Peer) BestHeight() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.bestHeight
+}
+
+// SetBestHeight - это функция, которая запоминает высоту блокчейна участника, если она больше известной.
+func (p *Peer) SetBestHeight(height int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if height > p.bestHeight {
+		p.bestHeight = height
+	}
+}
+
+// markTx - это функция, которая запоминает, что участник знает о транзакции txID.
+// Возвращает false, если это уже было известно.
+func (p *Peer) markTx(txID []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.knownTxs.add(txID)
+}
+
+// Score - это функция, которая возвращает штраф участника за нарушения.
+func (p *Peer) Score() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.score
+}
+
+// addScore - это функция, которая добавляет участнику штраф n и возвращает итоговый штраф.
+func (p *Peer) addScore(n int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.score += n
+	return p.score
+}
+
+// Close - это функция, которая закрывает соединение с участником.
+func (p *Peer) Close() error {
+	return p.conn.Close()
+}
+
+// String - это функция, которая возвращает адрес участника для сообщений в журнале.
+func (p *Peer) String() string {
+	if p.Inbound {
+		return p.Addr + " (inbound)"
+	}
+	return p.Addr
+}
+
+// bookAddr - это функция, которая возвращает адрес участника для адресной книги: адрес, по которому
+// мы к нему подключились, или адрес, на котором принимает соединения участник входящего соединения.
+func (p *Peer) bookAddr() string {
+	if p.Inbound {
+		return p.ListenAddr
+	}
+	return p.Addr
+}
+
+// host - это функция, которая возвращает IP-адрес участника: по нему узел блокирует участника.
+func (p *Peer) host() string {
+	return hostOf(p.conn.RemoteAddr().String())
+}
+
+// listenAddr - это функция, которая собирает адрес, на котором участник принимает соединения:
+// IP-адрес соединения и порт из его сообщения version.
+func listenAddr(conn net.Conn, port int) string {
+	if port <= 0 {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
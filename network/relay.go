@@ -0,0 +1,291 @@
+package network
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+)
+
+const (
+	// maxSeenTxs - это сколько ID последних полученных транзакций узел помнит, чтобы не принимать их повторно.
+	maxSeenTxs = 50000
+	// maxKnownTxs - это сколько ID транзакций узел помнит для каждого участника, чтобы не объявлять их повторно.
+	maxKnownTxs = 10000
+	// txRequestTimeout - это сколько узел ждет запрошенную транзакцию, прежде чем запросить ее у другого участника.
+	txRequestTimeout = 20 * time.Second
+)
+
+// idCache - это множество ID ограниченного размера. Когда оно заполнено, забываются самые старые ID.
+// Блокировку idCache обеспечивает владелец.
+type idCache struct {
+	max   int
+	ids   map[string]bool
+	order []string
+}
+
+// newIDCache - это функция, которая создает множество не больше чем из max ID.
+func newIDCache(max int) *idCache {
+	return &idCache{max: max, ids: make(map[string]bool)}
+}
+
+// add - это функция, которая добавляет ID. Возвращает false, если он уже был в множестве.
+func (c *idCache) add(id []byte) bool {
+	key := hex.EncodeToString(id)
+	if c.ids[key] {
+		return false
+	}
+	if len(c.order) >= c.max {
+		delete(c.ids, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.ids[key] = true
+	c.order = append(c.order, key)
+	return true
+}
+
+// has - это функция, которая проверяет, есть ли ID в множестве.
+func (c *idCache) has(id []byte) bool {
+	return c.ids[hex.EncodeToString(id)]
+}
+
+// Mempool - это функция, которая возвращает мемпул узла. До Start мемпула нет.
+func (s *Server) Mempool() *blockchain.Mempool {
+	return s.pool
+}
+
+// SubmitTransaction - это функция, которая проверяет транзакцию, добавляет ее в мемпул узла
+// и объявляет участникам.
+func (s *Server) SubmitTransaction(tx *blockchain.Transaction) error {
+	if s.pool == nil {
+		return ErrNotStarted
+	}
+	s.chainMu.Lock()
+	err := s.pool.Add(tx)
+	s.chainMu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.txMu.Lock()
+	s.seenTxs.add(tx.ID)
+	s.txMu.Unlock()
+
+	s.announceTx(nil, tx.ID)
+	return nil
+}
+
+// requestTxs - это функция, которая запрашивает у участника объявленные им транзакции,
+// которых узел еще не видел и не ждет от другого участника.
+// Пока узел догоняет блокчейн, транзакции не запрашиваются: их входы еще неизвестны.
+func (s *Server) requestTxs(peer *Peer, txIDs [][]byte) error {
+	height, err := s.BestHeight()
+	if err != nil {
+		return err
+	}
+	if height < s.targetHeight() {
+		s.txMu.Lock()
+		s.txsDeferred = true
+		s.txMu.Unlock()
+		return nil
+	}
+
+	var wanted [][]byte
+	s.txMu.Lock()
+	for _, txID := range txIDs {
+		peer.markTx(txID)
+		key := hex.EncodeToString(txID)
+		if s.seenTxs.has(txID) || s.pool.Contains(txID) {
+			continue
+		}
+		if requested, ok := s.txRequests[key]; ok && time.Since(requested) < txRequestTimeout {
+			continue
+		}
+		s.txRequests[key] = time.Now()
+		wanted = append(wanted, txID)
+	}
+	s.txMu.Unlock()
+
+	if len(wanted) == 0 {
+		return nil
+	}
+	return peer.Send(CmdGetData, GetData{InvTx, wanted})
+}
+
+// forgetTxRequests - это функция, которая снимает запросы транзакций, которых у участника не оказалось,
+// чтобы их можно было запросить у другого участника.
+func (s *Server) forgetTxRequests(txIDs [][]byte) {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	for _, txID := range txIDs {
+		delete(s.txRequests, hex.EncodeToString(txID))
+	}
+}
+
+// expireTxRequests - это функция, которая забывает запросы транзакций, не выполненные за txRequestTimeout.
+func (s *Server) expireTxRequests() {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	for key, requested := range s.txRequests {
+		if time.Since(requested) >= txRequestTimeout {
+			delete(s.txRequests, key)
+		}
+	}
+}
+
+// sendTxs - это функция, которая отправляет участнику запрошенные транзакции мемпула,
+// а ненайденные перечисляет в notfound.
+func (s *Server) sendTxs(peer *Peer, txIDs [][]byte) error {
+	var missing [][]byte
+	for _, txID := range txIDs {
+		tx, ok := s.pool.Get(txID)
+		if !ok {
+			missing = append(missing, txID)
+			continue
+		}
+		peer.markTx(txID)
+		if err := peer.Send(CmdTx, Tx{tx.Serialize()}); err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		return peer.Send(CmdNotFound, NotFound{InvTx, missing})
+	}
+	return nil
+}
+
+// handleTx - это обработчик tx: узел проверяет транзакцию, добавляет ее в мемпул и объявляет остальным участникам.
+// Каждая транзакция обрабатывается один раз, повторные копии от других участников пропускаются.
+// За транзакцию, нарушающую правила, участник получает штраф.
+func (s *Server) handleTx(peer *Peer, m *Message) error {
+	var msg Tx
+	if err := m.Decode(&msg); err != nil {
+		return err
+	}
+	tx, err := blockchain.DeserializeTransaction(msg.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadPayload, err)
+	}
+	peer.markTx(tx.ID)
+
+	s.txMu.Lock()
+	delete(s.txRequests, hex.EncodeToString(tx.ID))
+	fresh := s.seenTxs.add(tx.ID)
+	s.txMu.Unlock()
+	if !fresh {
+		return nil
+	}
+
+	s.chainMu.Lock()
+	err = s.pool.Add(tx)
+	s.chainMu.Unlock()
+	if errors.Is(err, blockchain.ErrMempoolExists) {
+		return nil
+	}
+	if err != nil {
+		// Транзакция, нарушающая правила, - это нарушение участника. Остальные причины, например
+		// неизвестный нам вход или конфликт в мемпуле, возможны и у честного участника.
+		if invalidTx(err) {
+			return fmt.Errorf("%w %x: %v", ErrInvalidTx, tx.ID, err)
+		}
+		s.logf("Rejected transaction %x from %s: %v", tx.ID, peer, err)
+		return nil
+	}
+	s.logf("Accepted transaction %x from %s", tx.ID, peer)
+	s.announceTx(peer, tx.ID)
+	return nil
+}
+
+// announceTx - это функция, которая объявляет транзакцию участникам, кроме from, которые о ней еще не знают.
+func (s *Server) announceTx(from *Peer, txID []byte) {
+	for _, other := range s.Peers() {
+		if other == from || !other.markTx(txID) {
+			continue
+		}
+		if err := other.Send(CmdInv, Inv{InvTx, [][]byte{txID}}); err != nil {
+			s.removePeer(other, err)
+		}
+	}
+}
+
+// requestMempools - это функция, которая после синхронизации запрашивает у участников их мемпулы,
+// если объявления транзакций пропускались, пока узел догонял блокчейн.
+func (s *Server) requestMempools() {
+	s.txMu.Lock()
+	deferred := s.txsDeferred
+	s.txsDeferred = false
+	s.txMu.Unlock()
+	if !deferred {
+		return
+	}
+	for _, peer := range s.Peers() {
+		if err := peer.Send(CmdMempool, MempoolRequest{}); err != nil {
+			s.removePeer(peer, err)
+		}
+	}
+}
+
+// handleMempool - это обработчик mempool: узел объявляет участнику все транзакции своего мемпула.
+func (s *Server) handleMempool(peer *Peer, m *Message) error {
+	var request MempoolRequest
+	if err := m.Decode(&request); err != nil {
+		return err
+	}
+	s.announceMempool(peer, true)
+	return nil
+}
+
+// announceMempool - это функция, которая объявляет участнику транзакции мемпула.
+// Если all ложно, пропускаются транзакции, о которых участник уже знает.
+func (s *Server) announceMempool(peer *Peer, all bool) {
+	if s.pool == nil {
+		return
+	}
+	var txIDs [][]byte
+	for _, txID := range s.pool.TxIDs() {
+		if peer.markTx(txID) || all {
+			txIDs = append(txIDs, txID)
+		}
+	}
+	for len(txIDs) > 0 {
+		n := len(txIDs)
+		if n > MaxInvItems {
+			n = MaxInvItems
+		}
+		if err := peer.Send(CmdInv, Inv{InvTx, txIDs[:n]}); err != nil {
+			s.removePeer(peer, err)
+			return
+		}
+		txIDs = txIDs[n:]
+	}
+}
+
+// handleGetUTXOs - это обработчик getutxos: узел отвечает выходами, которые хэш публичного ключа может потратить.
+// Выходы, потраченные транзакциями мемпула, не отдаются, чтобы новая транзакция с ними не конфликтовала.
+func (s *Server) handleGetUTXOs(peer *Peer, m *Message) error {
+	var request GetUTXOs
+	if err := m.Decode(&request); err != nil {
+		return err
+	}
+	s.chainMu.Lock()
+	UTXOSet := blockchain.UTXOSet{Blockchain: s.chain, Mempool: s.pool}
+	outs, err := UTXOSet.SpendableOutputs(request.PubKeyHash, blockchain.MaxMoney)
+	s.chainMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(outs) > MaxUTXOItems {
+		outs = outs[:MaxUTXOItems]
+	}
+	return peer.Send(CmdUTXOs, UTXOs{outs})
+}
+
+// removeBlockTxs - это функция, которая убирает из мемпула транзакции, попавшие в блоки.
+func (s *Server) removeBlockTxs(blocks []*blockchain.Block) {
+	for _, block := range blocks {
+		if err := s.pool.RemoveBlock(block); err != nil {
+			s.logf("Mempool: %v", err)
+		}
+	}
+}
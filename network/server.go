@@ -0,0 +1,489 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+)
+
+const (
+	// handshakeTimeout - это сколько узел ждет обмена сообщениями version и verack.
+	handshakeTimeout = 10 * time.Second
+	// dialTimeout - это сколько узел ждет установки исходящего соединения.
+	dialTimeout = 10 * time.Second
+)
+
+// Ошибки соединения с участниками.
+var (
+	ErrHandshake       = errors.New("handshake failed")
+	ErrProtocolVersion = errors.New("peer protocol version is too old")
+	ErrSelfConnect     = errors.New("connected to self")
+	ErrDuplicatePeer   = errors.New("peer is already connected")
+	ErrServerClosed    = errors.New("server is closed")
+	ErrNotStarted      = errors.New("server is not started")
+)
+
+// handler - это обработчик сообщения участника. Ошибка обработчика разрывает соединение,
+// а если это нарушение участника, еще и добавляет ему штраф.
+type handler func(peer *Peer, m *Message) error
+
+// Server - это узел сети: он принимает входящие соединения, подключается к другим узлам
+// и обменивается с ними сообщениями о блокчейне chain.
+type Server struct {
+	cfg   *config.Config
+	chain *blockchain.BlockChain
+	// chainMu - это блокировка блокчейна: BlockChain не рассчитан на работу из нескольких горутин.
+	chainMu sync.Mutex
+	// ListenAddr - это адрес, на котором узел принимает соединения, например ":3000".
+	ListenAddr string
+	// OnPeer - это функция, которую узел вызывает при подключении (connected = true) и отключении участника.
+	OnPeer func(peer *Peer, connected bool)
+	// OnProgress - это функция, которую узел вызывает после добавления полученных блоков:
+	// height - высота нашего блокчейна, target - наибольшая известная высота участников.
+	OnProgress func(height, target int)
+	// TargetOutbound - это сколько исходящих соединений узел поддерживает, подключаясь к адресам
+	// из адресной книги и seed-узлам. При 0 узел подключается только по Connect.
+	TargetOutbound int
+	// BanDuration - это на сколько узел блокирует участника, набравшего BanThreshold.
+	BanDuration time.Duration
+	// Logf - это функция, которой узел сообщает о событиях: участниках, рукопожатиях, синхронизации и блокировках.
+	// Если она не задана, сообщения никуда не выводятся.
+	Logf func(format string, args ...interface{})
+
+	nonce    uint64
+	handlers map[string]handler
+	sync     *blockSync
+	quit     chan struct{}
+	// pool - это мемпул узла, его загружает Start.
+	pool *blockchain.Mempool
+
+	// txMu - это блокировка seenTxs и txRequests.
+	txMu sync.Mutex
+	// seenTxs - это транзакции, которые узел уже получал.
+	seenTxs *idCache
+	// txRequests - это когда узел запросил транзакцию, которую еще не получил.
+	txRequests map[string]time.Time
+	// txsDeferred - это признак, что узел пропускал объявления транзакций, пока догонял блокчейн.
+	txsDeferred bool
+
+	// addrs - это адресная книга узла, ее загружает Start.
+	addrs *AddrBook
+	// dialing - это адреса, к которым узел сейчас подключается.
+	dialing map[string]bool
+	// connectNow - это сигнал connLoop проверить исходящие соединения.
+	connectNow chan struct{}
+	// bans - это список заблокированных узлов, его загружает Start.
+	bans *BanList
+	// scoreMu - это блокировка scores.
+	scoreMu sync.Mutex
+	// scores - это штрафы адресов участников, см. misbehave.
+	scores map[string]hostScore
+
+	mu       sync.Mutex
+	listener net.Listener
+	peers    map[string]*Peer
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer - это функция, которая создает узел сети cfg для блокчейна chain, слушающий listenAddr.
+func NewServer(cfg *config.Config, chain *blockchain.BlockChain, listenAddr string) *Server {
+	var nonce [8]byte
+	rand.Read(nonce[:])
+	s := &Server{
+		cfg:        cfg,
+		chain:      chain,
+		ListenAddr: listenAddr,
+		nonce:      binary.BigEndian.Uint64(nonce[:]),
+		peers:      make(map[string]*Peer),
+		sync:       newBlockSync(),
+		quit:       make(chan struct{}),
+		seenTxs:    newIDCache(maxSeenTxs),
+		txRequests: make(map[string]time.Time),
+		addrs:      NewAddrBook(cfg.PeersFile),
+		dialing:    make(map[string]bool),
+		connectNow: make(chan struct{}, 1),
+		bans:       NewBanList(cfg.BansFile),
+		scores:     make(map[string]hostScore),
+
+		TargetOutbound: DefaultTargetOutbound,
+		BanDuration:    DefaultBanDuration,
+	}
+	s.handlers = map[string]handler{
+		CmdVersion:   s.handleVersion,
+		CmdVerack:    s.handleVerack,
+		CmdGetBlocks: s.handleGetBlocks,
+		CmdInv:       s.handleInv,
+		CmdGetData:   s.handleGetData,
+		CmdBlock:     s.handleBlock,
+		CmdNotFound:  s.handleNotFound,
+		CmdTx:        s.handleTx,
+		CmdMempool:   s.handleMempool,
+		CmdGetAddr:   s.handleGetAddr,
+		CmdAddr:      s.handleAddr,
+		CmdGetUTXOs:  s.handleGetUTXOs,
+	}
+	return s
+}
+
+// Start - это функция, которая загружает мемпул, адресную книгу и список блокировок, начинает слушать ListenAddr,
+// принимать входящие соединения, синхронизировать блоки и подключаться к узлам из адресной книги.
+func (s *Server) Start() error {
+	if err := s.addrs.Load(); err != nil {
+		return err
+	}
+	if err := s.bans.Load(); err != nil {
+		return err
+	}
+	s.chainMu.Lock()
+	pool, err := blockchain.NewMempool(s.chain)
+	s.chainMu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.pool = pool
+
+	listener, err := net.Listen("tcp", s.ListenAddr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	s.wg.Add(3)
+	go s.acceptLoop(listener)
+	go s.syncLoop()
+	go s.connLoop()
+	return nil
+}
+
+// Addr - это функция, которая возвращает адрес, на котором узел принимает соединения.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Stop - это функция, которая перестает принимать соединения, отключает всех участников, ждет их горутины
+// и сохраняет адресную книгу и список блокировок.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	if !s.closed {
+		close(s.quit)
+	}
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for _, peer := range s.peers {
+		peer.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	if err := s.addrs.Save(); err != nil {
+		s.logf("Address book: %v", err)
+	}
+	if err := s.bans.Save(); err != nil {
+		s.logf("Ban list: %v", err)
+	}
+}
+
+// acceptLoop - это функция, которая принимает входящие соединения, пока listener не закрыт.
+func (s *Server) acceptLoop(listener net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		if host := hostOf(conn.RemoteAddr().String()); s.bans.IsBanned(host) {
+			conn.Close()
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			peer := newPeer(conn, s.cfg.Params.Magic, true)
+			if err := s.handshake(peer); err != nil {
+				s.logf("Rejected %s: %v", peer, err)
+				s.handshakeFailed(peer, err)
+				return
+			}
+			s.handlePeer(peer)
+		}()
+	}
+}
+
+// Connect - это функция, которая подключается к узлу addr и проводит с ним рукопожатие.
+// Сообщения участника обрабатываются в отдельной горутине до отключения.
+func (s *Server) Connect(addr string) (*Peer, error) {
+	if s.isClosed() {
+		return nil, ErrServerClosed
+	}
+	if s.bans.IsBanned(hostOf(addr)) {
+		return nil, fmt.Errorf("%w: %s", ErrBanned, addr)
+	}
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	peer := newPeer(conn, s.cfg.Params.Magic, false)
+	peer.Addr = addr
+	if err := s.handshake(peer); err != nil {
+		s.handshakeFailed(peer, err)
+		return nil, err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.handlePeer(peer)
+	}()
+	return peer, nil
+}
+
+// handshake - это функция, которая обменивается с участником сообщениями version и verack
+// и добавляет его в список участников.
+func (s *Server) handshake(peer *Peer) error {
+	peer.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer peer.conn.SetDeadline(time.Time{})
+
+	version, err := s.versionMessage()
+	if err != nil {
+		return err
+	}
+	if err := peer.Send(CmdVersion, version); err != nil {
+		return err
+	}
+
+	// Ошибку чтения не оборачиваем в ErrHandshake: обрыв соединения не нарушение,
+	// а чужая сеть или испорченное сообщение штрафуются по своей ошибке.
+	m, err := peer.receive()
+	if err != nil {
+		return fmt.Errorf("%v: %w", ErrHandshake, err)
+	}
+	if m.Command != CmdVersion {
+		return fmt.Errorf("%w: expected %s, got %s", ErrHandshake, CmdVersion, m.Command)
+	}
+	var theirs Version
+	if err := m.Decode(&theirs); err != nil {
+		return fmt.Errorf("%v: %w", ErrHandshake, err)
+	}
+	if theirs.Nonce == s.nonce {
+		return ErrSelfConnect
+	}
+	if theirs.Version < MinProtocolVersion {
+		return fmt.Errorf("%w: %d", ErrProtocolVersion, theirs.Version)
+	}
+	peer.Version = theirs.Version
+	peer.ListenAddr = listenAddr(peer.conn, theirs.ListenPort)
+	peer.SetBestHeight(theirs.BestHeight)
+
+	if err := peer.Send(CmdVerack, Verack{}); err != nil {
+		return err
+	}
+	m, err = peer.receive()
+	if err != nil {
+		return fmt.Errorf("%v: %w", ErrHandshake, err)
+	}
+	if m.Command != CmdVerack {
+		return fmt.Errorf("%w: expected %s, got %s", ErrHandshake, CmdVerack, m.Command)
+	}
+	return s.addPeer(peer)
+}
+
+// handshakeFailed - это функция, которая закрывает соединение после неудачного рукопожатия.
+// Если участник нарушил протокол, он получает штраф так же, как в handlePeer.
+func (s *Server) handshakeFailed(peer *Peer, err error) {
+	if score := misbehaviourScore(err); score > 0 {
+		s.misbehave(peer, score, err)
+	}
+	peer.Close()
+}
+
+// versionMessage - это функция, которая собирает сообщение version узла.
+func (s *Server) versionMessage() (Version, error) {
+	height, err := s.BestHeight()
+	if err != nil {
+		return Version{}, err
+	}
+	return Version{
+		Version:    ProtocolVersion,
+		BestHeight: height,
+		ListenPort: s.listenPort(),
+		Nonce:      s.nonce,
+		Timestamp:  time.Now().Unix(),
+	}, nil
+}
+
+// listenPort - это функция, которая возвращает порт, на котором узел принимает соединения, или 0.
+func (s *Server) listenPort() int {
+	addr := s.Addr()
+	if addr == nil {
+		return 0
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// BestHeight - это функция, которая возвращает высоту последнего блока узла.
+func (s *Server) BestHeight() (int, error) {
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	return s.chain.GetBestHeight()
+}
+
+// addPeer - это функция, которая добавляет участника, если узел еще не соединен с ним.
+func (s *Server) addPeer(peer *Peer) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	// Адрес Connect мог быть именем узла, поэтому блокировку проверяем и по IP-адресу соединения.
+	if s.bans.IsBanned(peer.host()) {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrBanned, peer.host())
+	}
+	for _, other := range s.peers {
+		if other.Addr == peer.Addr || (peer.ListenAddr != "" && other.ListenAddr == peer.ListenAddr) {
+			s.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrDuplicatePeer, peer.Addr)
+		}
+	}
+	s.peers[peer.Addr] = peer
+	s.mu.Unlock()
+
+	s.logf("Connected to %s, protocol %d, height %d", peer, peer.Version, peer.BestHeight())
+	if s.OnPeer != nil {
+		s.OnPeer(peer, true)
+	}
+	s.requestBlocks()
+	s.announceMempool(peer, false)
+
+	// Исходящий участник точно принимает соединения, а у входящего адрес берем из его сообщения version.
+	if addr := peer.bookAddr(); addr != "" {
+		if peer.Inbound {
+			s.addrs.Add(addr, time.Now())
+		} else {
+			s.addrs.Connected(addr)
+		}
+	}
+	if !peer.Inbound {
+		if err := peer.Send(CmdGetAddr, GetAddr{}); err != nil {
+			s.removePeer(peer, err)
+		}
+	}
+	return nil
+}
+
+// removePeer - это функция, которая убирает участника из списка и закрывает соединение.
+func (s *Server) removePeer(peer *Peer, reason error) {
+	s.mu.Lock()
+	_, ok := s.peers[peer.Addr]
+	delete(s.peers, peer.Addr)
+	if s.closed {
+		reason = ErrServerClosed
+	}
+	s.mu.Unlock()
+	peer.Close()
+
+	if !ok {
+		return
+	}
+	s.forgetPeer(peer)
+	if addr := peer.bookAddr(); addr != "" {
+		s.addrs.Add(addr, time.Now())
+	}
+	s.wakeConnLoop()
+	s.logf("Disconnected from %s: %v", peer, reason)
+	if s.OnPeer != nil {
+		s.OnPeer(peer, false)
+	}
+}
+
+// Peers - это функция, которая возвращает соединенных участников, отсортированных по адресу.
+func (s *Server) Peers() []*Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	peers := make([]*Peer, 0, len(s.peers))
+	for _, peer := range s.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Addr < peers[j].Addr })
+	return peers
+}
+
+// handlePeer - это функция, которая читает сообщения участника и передает их обработчикам до отключения.
+// За нарушения участник получает штраф. После нарушения в данных сообщения чтение продолжается,
+// пока участник не наберет BanThreshold, а после ошибки чтения поток сообщений уже не разобрать,
+// поэтому участник отключается.
+func (s *Server) handlePeer(peer *Peer) {
+	for {
+		m, err := peer.receive()
+		if err != nil {
+			if score := misbehaviourScore(err); score > 0 && s.misbehave(peer, score, err) {
+				return
+			}
+			s.removePeer(peer, err)
+			return
+		}
+		h, ok := s.handlers[m.Command]
+		if !ok {
+			// Неизвестные команды пропускаем: их может посылать узел с более новой версией протокола.
+			continue
+		}
+		err = h(peer, m)
+		if err == nil {
+			continue
+		}
+		score := misbehaviourScore(err)
+		if score == 0 {
+			s.removePeer(peer, err)
+			return
+		}
+		if s.misbehave(peer, score, err) {
+			return
+		}
+	}
+}
+
+// handleVersion - это обработчик повторного сообщения version: после рукопожатия оно запрещено.
+func (s *Server) handleVersion(peer *Peer, m *Message) error {
+	return fmt.Errorf("%w: duplicate %s", ErrHandshake, CmdVersion)
+}
+
+// handleVerack - это обработчик повторного сообщения verack: после рукопожатия оно запрещено.
+func (s *Server) handleVerack(peer *Peer, m *Message) error {
+	return fmt.Errorf("%w: duplicate %s", ErrHandshake, CmdVerack)
+}
+
+// isClosed - это функция, которая проверяет, остановлен ли узел.
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// logf - это функция, которая передает сообщение узла в Logf, если она задана.
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
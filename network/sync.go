@@ -0,0 +1,563 @@
+package network
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+)
+
+const (
+	// maxBlocksInFlight - это сколько блоков узел одновременно запрашивает у одного участника.
+	maxBlocksInFlight = 16
+	// blockTimeout - это сколько узел ждет запрошенный блок, прежде чем запросить его у другого участника.
+	blockTimeout = 20 * time.Second
+	// getBlocksInterval - это как часто узел повторяет getblocks участнику, который не ответил.
+	getBlocksInterval = 5 * time.Second
+	// syncTick - это период проверки зависших загрузок.
+	syncTick = time.Second
+	// maxOrphans - это сколько блоков с неизвестным родителем узел держит в памяти.
+	maxOrphans = 1000
+	// maxPeerOrphans - это сколько блоков-сирот узел держит от одного участника.
+	maxPeerOrphans = 100
+	// orphanTTL - это сколько блок-сирота ждет своего родителя, прежде чем узел его забудет.
+	orphanTTL = 10 * time.Minute
+)
+
+// ErrTooManyItems - это ошибка сообщения, в котором больше MaxInvItems объектов.
+var ErrTooManyItems = errors.New("too many inventory items")
+
+// download - это блок, который нужно скачать.
+type download struct {
+	hash []byte
+	// peer - это участник, у которого блок запрошен, или nil, если блок ждет в очереди.
+	peer      *Peer
+	requested time.Time
+	// sources - это участники, которые объявили, что блок у них есть.
+	sources map[*Peer]bool
+}
+
+// orphan - это блок, родителя которого еще нет.
+type orphan struct {
+	block *blockchain.Block
+	// peer - это участник, который прислал блок.
+	peer  *Peer
+	added time.Time
+}
+
+// blockSync - это состояние загрузки блоков. Блоки скачиваются параллельно у всех участников,
+// которые их объявили, и применяются к блокчейну по мере того, как становится известен их родитель.
+type blockSync struct {
+	mu        sync.Mutex
+	downloads map[string]*download
+	// order - это ключи downloads в порядке объявления, блоки запрашиваются в нем.
+	order []string
+	// inFlight - это число запрошенных у участника и еще не полученных блоков.
+	inFlight map[*Peer]int
+	// getBlocks - это когда участнику последний раз отправлен getblocks, на который он еще не ответил.
+	getBlocks map[*Peer]time.Time
+	// orphans - это полученные блоки, родителя которых еще нет, по хэшу родителя.
+	orphans map[string][]*orphan
+	// orphanByHash - это те же блоки по их собственному хэшу.
+	orphanByHash map[string]*orphan
+	// peerOrphans - это число блоков-сирот, присланных участником.
+	peerOrphans map[*Peer]int
+}
+
+// newBlockSync - это функция, которая создает пустое состояние загрузки блоков.
+func newBlockSync() *blockSync {
+	return &blockSync{
+		downloads:    make(map[string]*download),
+		inFlight:     make(map[*Peer]int),
+		getBlocks:    make(map[*Peer]time.Time),
+		orphans:      make(map[string][]*orphan),
+		orphanByHash: make(map[string]*orphan),
+		peerOrphans:  make(map[*Peer]int),
+	}
+}
+
+// syncLoop - это функция, которая периодически перезапрашивает зависшие блоки и транзакции и продолжает синхронизацию.
+func (s *Server) syncLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(syncTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			s.expireDownloads()
+			s.sync.expireOrphans()
+			s.expireTxRequests()
+			s.scheduleDownloads()
+			s.requestBlocks()
+		}
+	}
+}
+
+// requestBlocks - это функция, которая отправляет getblocks участникам с более длинным блокчейном,
+// если узлу больше нечего скачивать. Если остались сироты, ответ на getblocks укажет их недостающих родителей.
+func (s *Server) requestBlocks() {
+	height, err := s.BestHeight()
+	if err != nil {
+		s.logf("Sync: %v", err)
+		return
+	}
+	s.sync.mu.Lock()
+	if len(s.sync.downloads) > 0 {
+		s.sync.mu.Unlock()
+		return
+	}
+	var ask []*Peer
+	for _, peer := range s.Peers() {
+		if peer.BestHeight() <= height {
+			continue
+		}
+		if sent, ok := s.sync.getBlocks[peer]; ok && time.Since(sent) < getBlocksInterval {
+			continue
+		}
+		s.sync.getBlocks[peer] = time.Now()
+		ask = append(ask, peer)
+	}
+	s.sync.mu.Unlock()
+	if len(ask) == 0 {
+		return
+	}
+
+	s.chainMu.Lock()
+	locator, err := s.chain.BlockLocator()
+	s.chainMu.Unlock()
+	if err != nil {
+		s.logf("Sync: %v", err)
+		return
+	}
+	for _, peer := range ask {
+		if err := peer.Send(CmdGetBlocks, GetBlocks{locator}); err != nil {
+			s.removePeer(peer, err)
+		}
+	}
+}
+
+// handleGetBlocks - это обработчик getblocks: узел отвечает хэшами блоков после общего с участником блока.
+func (s *Server) handleGetBlocks(peer *Peer, m *Message) error {
+	var request GetBlocks
+	if err := m.Decode(&request); err != nil {
+		return err
+	}
+	if len(request.Locator) > MaxInvItems {
+		return fmt.Errorf("%w: %s with %d hashes", ErrTooManyItems, m.Command, len(request.Locator))
+	}
+	s.chainMu.Lock()
+	hashes, err := s.chain.BlockHashesAfter(request.Locator, MaxInvItems)
+	s.chainMu.Unlock()
+	if err != nil || len(hashes) == 0 {
+		return err
+	}
+	return peer.Send(CmdInv, Inv{InvBlock, hashes})
+}
+
+// handleInv - это обработчик inv: неизвестные блоки ставятся в очередь загрузки, а новые транзакции запрашиваются.
+func (s *Server) handleInv(peer *Peer, m *Message) error {
+	var inv Inv
+	if err := m.Decode(&inv); err != nil {
+		return err
+	}
+	if len(inv.Items) > MaxInvItems {
+		return fmt.Errorf("%w: %s with %d items", ErrTooManyItems, m.Command, len(inv.Items))
+	}
+	if inv.Type == InvTx {
+		return s.requestTxs(peer, inv.Items)
+	}
+	if inv.Type != InvBlock {
+		return nil
+	}
+
+	// Отбираем блоки, которых нет в блокчейне.
+	s.chainMu.Lock()
+	var unknown [][]byte
+	for _, hash := range inv.Items {
+		if !s.chain.HasBlock(hash) {
+			unknown = append(unknown, hash)
+		}
+	}
+	s.chainMu.Unlock()
+
+	s.sync.mu.Lock()
+	delete(s.sync.getBlocks, peer)
+	for _, hash := range unknown {
+		key := hex.EncodeToString(hash)
+		d, ok := s.sync.downloads[key]
+		if !ok {
+			if s.sync.hasOrphan(hash) {
+				continue
+			}
+			d = &download{hash: hash, sources: make(map[*Peer]bool)}
+			s.sync.downloads[key] = d
+			s.sync.order = append(s.sync.order, key)
+		}
+		d.sources[peer] = true
+	}
+	s.sync.mu.Unlock()
+
+	s.scheduleDownloads()
+	return nil
+}
+
+// scheduleDownloads - это функция, которая распределяет блоки из очереди между участниками, у которых они есть.
+// Каждый блок запрашивается у наименее загруженного из объявивших его участников.
+func (s *Server) scheduleDownloads() {
+	requests := make(map[*Peer][][]byte)
+
+	s.sync.mu.Lock()
+	order := s.sync.order[:0]
+	for _, key := range s.sync.order {
+		d, ok := s.sync.downloads[key]
+		if !ok {
+			continue
+		}
+		order = append(order, key)
+		if d.peer != nil {
+			continue
+		}
+		var best *Peer
+		for peer := range d.sources {
+			if s.sync.inFlight[peer] >= maxBlocksInFlight {
+				continue
+			}
+			if best == nil || s.sync.inFlight[peer] < s.sync.inFlight[best] {
+				best = peer
+			}
+		}
+		if best == nil {
+			continue
+		}
+		d.peer = best
+		d.requested = time.Now()
+		s.sync.inFlight[best]++
+		requests[best] = append(requests[best], d.hash)
+	}
+	s.sync.order = order
+	s.sync.mu.Unlock()
+
+	for peer, hashes := range requests {
+		if err := peer.Send(CmdGetData, GetData{InvBlock, hashes}); err != nil {
+			s.removePeer(peer, err)
+		}
+	}
+}
+
+// expireDownloads - это функция, которая снимает с участников блоки, которые они не прислали за blockTimeout.
+// Такой блок запрашивается у другого объявившего его участника, а если их нет, забывается.
+func (s *Server) expireDownloads() {
+	s.sync.mu.Lock()
+	defer s.sync.mu.Unlock()
+	for key, d := range s.sync.downloads {
+		if d.peer == nil || time.Since(d.requested) < blockTimeout {
+			continue
+		}
+		s.sync.inFlight[d.peer]--
+		delete(d.sources, d.peer)
+		d.peer = nil
+		if len(d.sources) == 0 {
+			delete(s.sync.downloads, key)
+		}
+	}
+}
+
+// forgetPeer - это функция, которая убирает отключенного участника из загрузок.
+// Запрошенные у него блоки возвращаются в очередь.
+func (s *Server) forgetPeer(peer *Peer) {
+	s.sync.mu.Lock()
+	for key, d := range s.sync.downloads {
+		delete(d.sources, peer)
+		if d.peer == peer {
+			d.peer = nil
+		}
+		if len(d.sources) == 0 && d.peer == nil {
+			delete(s.sync.downloads, key)
+		}
+	}
+	delete(s.sync.inFlight, peer)
+	delete(s.sync.getBlocks, peer)
+	s.sync.forgetOrphans(peer)
+	s.sync.mu.Unlock()
+
+	s.scheduleDownloads()
+}
+
+// handleGetData - это обработчик getdata: узел отправляет запрошенные блоки и транзакции,
+// а ненайденные перечисляет в notfound.
+func (s *Server) handleGetData(peer *Peer, m *Message) error {
+	var request GetData
+	if err := m.Decode(&request); err != nil {
+		return err
+	}
+	if len(request.Items) > MaxInvItems {
+		return fmt.Errorf("%w: %s with %d items", ErrTooManyItems, m.Command, len(request.Items))
+	}
+	if request.Type == InvTx {
+		return s.sendTxs(peer, request.Items)
+	}
+	if request.Type != InvBlock {
+		return peer.Send(CmdNotFound, NotFound{request.Type, request.Items})
+	}
+
+	var missing [][]byte
+	for _, hash := range request.Items {
+		s.chainMu.Lock()
+		block, err := s.chain.GetBlock(hash)
+		s.chainMu.Unlock()
+		if err != nil {
+			missing = append(missing, hash)
+			continue
+		}
+		if err := peer.Send(CmdBlock, Block{block.Serialize()}); err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		return peer.Send(CmdNotFound, NotFound{InvBlock, missing})
+	}
+	return nil
+}
+
+// handleNotFound - это обработчик notfound: блоки и транзакции, которых у участника нет, запрашиваются у других.
+func (s *Server) handleNotFound(peer *Peer, m *Message) error {
+	var notFound NotFound
+	if err := m.Decode(&notFound); err != nil {
+		return err
+	}
+	if len(notFound.Items) > MaxInvItems {
+		return fmt.Errorf("%w: %s with %d items", ErrTooManyItems, m.Command, len(notFound.Items))
+	}
+	if notFound.Type == InvTx {
+		s.forgetTxRequests(notFound.Items)
+		return nil
+	}
+	if notFound.Type != InvBlock {
+		return nil
+	}
+
+	s.sync.mu.Lock()
+	for _, hash := range notFound.Items {
+		key := hex.EncodeToString(hash)
+		d, ok := s.sync.downloads[key]
+		if !ok {
+			continue
+		}
+		delete(d.sources, peer)
+		if d.peer == peer {
+			d.peer = nil
+			s.sync.inFlight[peer]--
+		}
+		if len(d.sources) == 0 && d.peer == nil {
+			delete(s.sync.downloads, key)
+		}
+	}
+	s.sync.mu.Unlock()
+
+	s.scheduleDownloads()
+	return nil
+}
+
+// handleBlock - это обработчик block: узел проверяет блок и добавляет его в блокчейн.
+// Недействительный блок разрывает соединение с участником.
+func (s *Server) handleBlock(peer *Peer, m *Message) error {
+	var msg Block
+	if err := m.Decode(&msg); err != nil {
+		return err
+	}
+	block, err := blockchain.Deserialize(msg.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadPayload, err)
+	}
+
+	s.sync.mu.Lock()
+	key := hex.EncodeToString(block.Hash)
+	if d, ok := s.sync.downloads[key]; ok {
+		if d.peer != nil {
+			s.sync.inFlight[d.peer]--
+		}
+		delete(s.sync.downloads, key)
+	}
+	s.sync.mu.Unlock()
+
+	if err := s.processBlock(peer, block); err != nil {
+		return err
+	}
+	// Высоту участника запоминаем только по принятому блоку, иначе участник мог бы завысить ее любым блоком.
+	peer.SetBestHeight(block.Height)
+	s.scheduleDownloads()
+	s.requestBlocks()
+	return nil
+}
+
+// processBlock - это функция, которая добавляет блок в блокчейн вместе с ждущими его блоками-сиротами.
+// Блок, родителя которого еще нет, откладывается до прихода родителя.
+func (s *Server) processBlock(peer *Peer, block *blockchain.Block) error {
+	s.chainMu.Lock()
+	if s.chain.HasBlock(block.Hash) {
+		s.chainMu.Unlock()
+		return nil
+	}
+	if len(block.PrevHash) > 0 && !s.chain.HasBlock(block.PrevHash) {
+		// Сироту нельзя проверить целиком, но без родителя проверяется все, что не зависит от блокчейна,
+		// в том числе печать: иначе память узла можно было бы занять блоками, которые ничего не стоили.
+		if err := s.chain.CheckOrphanHeader(block); err != nil {
+			s.chainMu.Unlock()
+			if invalidBlock(err) {
+				return fmt.Errorf("%w %x: %v", ErrInvalidBlock, block.Hash, err)
+			}
+			return fmt.Errorf("orphan block %x: %w", block.Hash, err)
+		}
+		// Сироту откладываем под блокировкой блокчейна, иначе родитель может успеть добавиться раньше.
+		s.sync.addOrphan(peer, block)
+		s.chainMu.Unlock()
+		return nil
+	}
+
+	var accepted []*blockchain.Block
+	queue := []*blockchain.Block{block}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if err := s.chain.AcceptBlock(next); err != nil {
+			if next == block {
+				s.chainMu.Unlock()
+				if invalidBlock(err) {
+					return fmt.Errorf("%w %x: %v", ErrInvalidBlock, next.Hash, err)
+				}
+				return fmt.Errorf("invalid block %x: %w", next.Hash, err)
+			}
+			s.logf("Dropping block %x: %v", next.Hash, err)
+			continue
+		}
+		accepted = append(accepted, next)
+		queue = append(queue, s.sync.takeOrphans(next.Hash)...)
+	}
+	height, err := s.chain.GetBestHeight()
+	tip := s.chain.LastHash()
+	s.chainMu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.removeBlockTxs(accepted)
+
+	target := s.targetHeight()
+	if s.OnProgress != nil {
+		s.OnProgress(height, target)
+	}
+	// Новый последний блок объявляем остальным участникам, только когда догнали сеть.
+	if height >= target && len(accepted) > 0 {
+		s.announce(peer, height, tip)
+		s.requestMempools()
+	}
+	return nil
+}
+
+// announce - это функция, которая объявляет последний блок tip участникам, кроме from, у которых блокчейн короче.
+func (s *Server) announce(from *Peer, height int, tip []byte) {
+	for _, other := range s.Peers() {
+		if other == from || other.BestHeight() >= height {
+			continue
+		}
+		if err := other.Send(CmdInv, Inv{InvBlock, [][]byte{tip}}); err != nil {
+			s.removePeer(other, err)
+		}
+	}
+}
+
+// targetHeight - это функция, которая возвращает наибольшую известную высоту блокчейна участников.
+func (s *Server) targetHeight() int {
+	target := -1
+	for _, peer := range s.Peers() {
+		if h := peer.BestHeight(); h > target {
+			target = h
+		}
+	}
+	return target
+}
+
+// addOrphan - это функция, которая откладывает блок участника peer до прихода его родителя.
+// Если сирот слишком много всего или от этого участника, блок отбрасывается: его снова скачают при следующем getblocks.
+func (bs *blockSync) addOrphan(peer *Peer, block *blockchain.Block) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	key := hex.EncodeToString(block.Hash)
+	if _, ok := bs.orphanByHash[key]; ok {
+		return
+	}
+	if len(bs.orphanByHash) >= maxOrphans || bs.peerOrphans[peer] >= maxPeerOrphans {
+		return
+	}
+	o := &orphan{block: block, peer: peer, added: time.Now()}
+	parent := hex.EncodeToString(block.PrevHash)
+	bs.orphans[parent] = append(bs.orphans[parent], o)
+	bs.orphanByHash[key] = o
+	bs.peerOrphans[peer]++
+}
+
+// takeOrphans - это функция, которая забирает блоки, ждущие родителя parentHash.
+func (bs *blockSync) takeOrphans(parentHash []byte) []*blockchain.Block {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	// removeOrphan меняет список детей parentHash, поэтому обходим его копию.
+	children := append([]*orphan(nil), bs.orphans[hex.EncodeToString(parentHash)]...)
+	blocks := make([]*blockchain.Block, 0, len(children))
+	for _, o := range children {
+		bs.removeOrphan(o)
+		blocks = append(blocks, o.block)
+	}
+	return blocks
+}
+
+// expireOrphans - это функция, которая забывает блоки-сироты, ждущие родителя дольше orphanTTL.
+func (bs *blockSync) expireOrphans() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	for _, o := range bs.orphanByHash {
+		if time.Since(o.added) >= orphanTTL {
+			bs.removeOrphan(o)
+		}
+	}
+}
+
+// forgetOrphans - это функция, которая забывает блоки-сироты отключенного участника peer. Вызывается под блокировкой.
+func (bs *blockSync) forgetOrphans(peer *Peer) {
+	for _, o := range bs.orphanByHash {
+		if o.peer == peer {
+			bs.removeOrphan(o)
+		}
+	}
+	delete(bs.peerOrphans, peer)
+}
+
+// removeOrphan - это функция, которая убирает блок-сироту из всех индексов. Вызывается под блокировкой.
+func (bs *blockSync) removeOrphan(o *orphan) {
+	delete(bs.orphanByHash, hex.EncodeToString(o.block.Hash))
+	if bs.peerOrphans[o.peer]--; bs.peerOrphans[o.peer] <= 0 {
+		delete(bs.peerOrphans, o.peer)
+	}
+	parent := hex.EncodeToString(o.block.PrevHash)
+	siblings := bs.orphans[parent]
+	for i, sibling := range siblings {
+		if sibling == o {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(bs.orphans, parent)
+	} else {
+		bs.orphans[parent] = siblings
+	}
+}
+
+// hasOrphan - это функция, которая проверяет, отложен ли блок hash. Вызывается под блокировкой.
+func (bs *blockSync) hasOrphan(hash []byte) bool {
+	_, ok := bs.orphanByHash[hex.EncodeToString(hash)]
+	return ok
+}
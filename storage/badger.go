@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"os"
+
+	"github.com/dgraph-io/badger"
+)
+
+// BadgerStore - это хранилище на диске в базе данных badger.
+type BadgerStore struct {
+	db *badger.DB
+}
+
+// OpenBadger - это функция, которая открывает или создает базу данных badger в папке dir.
+func OpenBadger(dir string) (*BadgerStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	opts := badger.DefaultOptions(dir)
+	opts.Dir = dir
+	opts.ValueDir = dir
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerStore{db}, nil
+}
+
+// Get - это функция, которая возвращает копию значения ключа или ErrNotFound.
+func (s *BadgerStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	return value, err
+}
+
+// Put - это функция, которая записывает значение ключа.
+func (s *BadgerStore) Put(key, value []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, value)
+	})
+}
+
+// Delete - это функция, которая удаляет ключ.
+func (s *BadgerStore) Delete(key []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(key)
+	})
+}
+
+// NewBatch - это функция, которая создает пакет, записываемый одной транзакцией badger.
+// Пакет должен помещаться в одну транзакцию, иначе Write вернет badger.ErrTxnTooBig.
+func (s *BadgerStore) NewBatch() Batch {
+	return newBatch(s, func(ops []*op) error {
+		return s.db.Update(func(txn *badger.Txn) error {
+			for _, o := range ops {
+				var err error
+				if o.value == nil {
+					err = txn.Delete(o.key)
+				} else {
+					err = txn.Set(o.key, o.value)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Iterate - это функция, которая обходит ключи с префиксом по возрастанию внутри одной транзакции чтения.
+func (s *BadgerStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(item.KeyCopy(nil), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == ErrStopIteration {
+		return nil
+	}
+	return err
+}
+
+// Close - это функция, которая закрывает базу данных.
+func (s *BadgerStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore - это хранилище в памяти. Оно ничего не пишет на диск,
+// поэтому подходит для тестов и узлов, которым не нужно сохранять блокчейн.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryStore - это функция, которая создает пустое хранилище в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+// Get - это функция, которая возвращает копию значения ключа или ErrNotFound.
+func (s *MemoryStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Put - это функция, которая записывает копию значения ключа.
+func (s *MemoryStore) Put(key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete - это функция, которая удаляет ключ.
+func (s *MemoryStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, string(key))
+	return nil
+}
+
+// NewBatch - это функция, которая создает пакет, записываемый под одной блокировкой.
+func (s *MemoryStore) NewBatch() Batch {
+	return newBatch(s, func(ops []*op) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, o := range ops {
+			if o.value == nil {
+				delete(s.data, string(o.key))
+			} else {
+				s.data[string(o.key)] = o.value
+			}
+		}
+		return nil
+	})
+}
+
+// Iterate - это функция, которая обходит ключи с префиксом по возрастанию.
+// Обход идет по снимку хранилища, поэтому fn может менять хранилище.
+func (s *MemoryStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	var keys []string
+	for key := range s.data {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	values := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		values[key] = s.data[key]
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		err := fn([]byte(key), append([]byte{}, values[key]...))
+		if err == ErrStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close - это функция, которая ничего не делает: хранилищу в памяти нечего закрывать.
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+// Ошибки хранилища.
+var (
+	// ErrNotFound - это ошибка, которую Get возвращает для отсутствующего ключа.
+	ErrNotFound = errors.New("key not found")
+	// ErrStopIteration - это ошибка, которую функция обхода возвращает, чтобы остановить Iterate без ошибки.
+	ErrStopIteration = errors.New("stop iteration")
+)
+
+// Store - это хранилище ключ-значение, в котором блокчейн держит блоки, индексы и мемпул.
+// Блокчейн работает только через этот интерфейс, поэтому хранилище можно заменить, не меняя его код.
+type Store interface {
+	// Get - это функция, которая возвращает копию значения ключа или ErrNotFound.
+	Get(key []byte) ([]byte, error)
+	// Put - это функция, которая записывает значение ключа.
+	Put(key, value []byte) error
+	// Delete - это функция, которая удаляет ключ. Удаление отсутствующего ключа не ошибка.
+	Delete(key []byte) error
+	// NewBatch - это функция, которая создает пакет изменений, записываемых атомарно.
+	NewBatch() Batch
+	// Iterate - это функция, которая обходит ключи с префиксом prefix по возрастанию и вызывает для них fn.
+	// Ключ и значение - это копии, их можно сохранять. Если fn возвращает ErrStopIteration,
+	// обход останавливается и Iterate возвращает nil, любая другая ошибка возвращается как есть.
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+	// Close - это функция, которая закрывает хранилище.
+	Close() error
+}
+
+// Batch - это пакет изменений хранилища. Изменения не видны другим, пока не вызван Write,
+// а Write записывает их все или ни одного.
+type Batch interface {
+	// Get - это функция, которая возвращает значение ключа с учетом изменений пакета.
+	Get(key []byte) ([]byte, error)
+	// Put - это функция, которая добавляет в пакет запись ключа.
+	Put(key, value []byte) error
+	// Delete - это функция, которая добавляет в пакет удаление ключа.
+	Delete(key []byte) error
+	// Write - это функция, которая атомарно записывает изменения пакета в хранилище.
+	Write() error
+}
+
+// op - это одно изменение пакета. value равен nil для удаления.
+type op struct {
+	key   []byte
+	value []byte
+}
+
+// batch - это пакет, который копит изменения в памяти и отдает их commit одним списком.
+// Get сначала смотрит в изменения пакета, а затем читает хранилище.
+type batch struct {
+	store   Store
+	pending map[string]*op
+	commit  func(ops []*op) error
+}
+
+// newBatch - это функция, которая создает пакет для store, записывающий изменения функцией commit.
+func newBatch(store Store, commit func(ops []*op) error) *batch {
+	return &batch{store, make(map[string]*op), commit}
+}
+
+func (b *batch) Get(key []byte) ([]byte, error) {
+	if o, ok := b.pending[string(key)]; ok {
+		if o.value == nil {
+			return nil, ErrNotFound
+		}
+		return append([]byte{}, o.value...), nil
+	}
+	return b.store.Get(key)
+}
+
+func (b *batch) Put(key, value []byte) error {
+	b.pending[string(key)] = &op{append([]byte{}, key...), append([]byte{}, value...)}
+	return nil
+}
+
+func (b *batch) Delete(key []byte) error {
+	b.pending[string(key)] = &op{append([]byte{}, key...), nil}
+	return nil
+}
+
+func (b *batch) Write() error {
+	ops := make([]*op, 0, len(b.pending))
+	for _, o := range b.pending {
+		ops = append(ops, o)
+	}
+	// Порядок записи не влияет на результат, но с ним поведение хранилищ одинаково.
+	sort.Slice(ops, func(i, j int) bool { return bytes.Compare(ops[i].key, ops[j].key) < 0 })
+	if err := b.commit(ops); err != nil {
+		return err
+	}
+	b.pending = make(map[string]*op)
+	return nil
+}
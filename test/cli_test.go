@@ -0,0 +1,29 @@
+package wallet_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/cli"
+)
+
+// TestExitCodeRejected - это функция, которая проверяет, что ошибки проверки транзакции дают код ExitRejected.
+func TestExitCodeRejected(t *testing.T) {
+	errs := []error{
+		blockchain.ErrBadSignature,
+		blockchain.ErrDoubleSpend,
+		blockchain.ErrMissingInput,
+		blockchain.ErrValueMismatch,
+		blockchain.ErrImmatureSpend,
+		blockchain.ErrBadValue,
+		blockchain.ErrBadTxID,
+		blockchain.ErrDuplicateTx,
+	}
+	for _, e := range errs {
+		err := fmt.Errorf("%w: tx 00ff", e)
+		if code := cli.ExitCode(err); code != cli.ExitRejected {
+			t.Errorf("ExitCode(%v) = %d, want %d", err, code, cli.ExitRejected)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package wallet_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+	"github.com/fenix1851/golang-blockchain/storage"
+)
+
+// TestNetworkPresets - это функция, которая проверяет, что у сетей разные генезис, версия адресов и magic-байты.
+func TestNetworkPresets(t *testing.T) {
+	seenGenesis := make(map[string]string)
+	seenVersion := make(map[byte]string)
+	seenMagic := make(map[[4]byte]string)
+
+	for name, params := range config.Networks {
+		if got, err := config.Network(name); err != nil || got != params {
+			t.Errorf("Network(%q) = %v, %v", name, got, err)
+		}
+		if other, ok := seenGenesis[params.GenesisData]; ok {
+			t.Errorf("%s and %s share genesis data", name, other)
+		}
+		if other, ok := seenVersion[params.AddressVersion]; ok {
+			t.Errorf("%s and %s share address version", name, other)
+		}
+		if other, ok := seenMagic[params.Magic]; ok {
+			t.Errorf("%s and %s share magic bytes", name, other)
+		}
+		seenGenesis[params.GenesisData] = name
+		seenVersion[params.AddressVersion] = name
+		seenMagic[params.Magic] = name
+	}
+
+	if _, err := config.Network("unknown"); err == nil {
+		t.Error("Unknown network accepted")
+	}
+}
+
+// TestGenesisBlock - это функция, которая проверяет, что генезис-блок каждой сети совпадает с ее GenesisHash,
+// а узел не принимает генезис-блок другой сети.
+func TestGenesisBlock(t *testing.T) {
+	for name, params := range config.Networks {
+		genesis := blockchain.GenesisBlock(params)
+		if got := hex.EncodeToString(genesis.Hash); got != params.GenesisHash {
+			t.Errorf("%s: genesis hash %s, want %s", name, got, params.GenesisHash)
+		}
+		if !blockchain.NewProof(genesis).Validate() {
+			t.Errorf("%s: genesis block has invalid proof of work", name)
+		}
+	}
+
+	chain := newEmptyChain(t, &config.RegTest)
+	if err := chain.AcceptBlock(blockchain.GenesisBlock(&config.TestNet)); !errors.Is(err, blockchain.ErrBadGenesis) {
+		t.Errorf("Genesis of another network: got %v, want %v", err, blockchain.ErrBadGenesis)
+	}
+	if err := chain.AcceptBlock(blockchain.GenesisBlock(&config.RegTest)); err != nil {
+		t.Errorf("Own genesis rejected: %v", err)
+	}
+
+	// Параметры, которые не дают свой же генезис-блок, не годятся для создания блокчейна.
+	broken := config.RegTest
+	broken.GenesisTime++
+	if _, err := blockchain.InitBlockChainWithStore(storage.NewMemoryStore(), &broken, blockchain.InstantSealEngine{}); !errors.Is(err, blockchain.ErrBadGenesis) {
+		t.Errorf("Broken genesis parameters: got %v, want %v", err, blockchain.ErrBadGenesis)
+	}
+}
@@ -0,0 +1,63 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+)
+
+// TestInstantSealEngine - это функция, которая проверяет, что мгновенно запечатанный блок проходит проверку,
+// а блок с измененным заголовком или сложностью - нет.
+func TestInstantSealEngine(t *testing.T) {
+	var engine blockchain.Consensus = blockchain.InstantSealEngine{}
+	block := newMinerBlock(t, config.MainNet.Difficulty)
+
+	if err := engine.Prepare(nil, block); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Seal(context.Background(), nil, block); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.VerifyHeader(nil, block); err != nil {
+		t.Fatalf("Sealed block rejected: %v", err)
+	}
+
+	block.Nonce++
+	if err := engine.VerifyHeader(nil, block); !errors.Is(err, blockchain.ErrBadBlockHash) {
+		t.Errorf("Tampered header: got %v, want %v", err, blockchain.ErrBadBlockHash)
+	}
+	block.Nonce--
+
+	block.Bits = 1
+	if err := engine.VerifyHeader(nil, block); !errors.Is(err, blockchain.ErrInvalidProof) {
+		t.Errorf("Nonzero bits: got %v, want %v", err, blockchain.ErrInvalidProof)
+	}
+}
+
+// TestCheckSeal - это функция, которая проверяет, что печать каждого блока блокчейна, включая генезис-блок,
+// проходит проверку, а подмененный генезис-блок - нет.
+func TestCheckSeal(t *testing.T) {
+	chain := newTestChain(t, &config.RegTest, 2)
+	iter := chain.Iterator()
+	for {
+		block, err := iter.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := chain.CheckSeal(block); err != nil {
+			t.Errorf("Block %d rejected: %v", block.Height, err)
+		}
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	genesis := blockchain.GenesisBlock(&config.RegTest)
+	genesis.Nonce++
+	if err := chain.CheckSeal(genesis); err == nil {
+		t.Error("Tampered genesis block accepted")
+	}
+}
@@ -0,0 +1,127 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+	"github.com/fenix1851/golang-blockchain/storage"
+)
+
+// TestCalculateBits - это функция, которая проверяет пересчет сложности.
+func TestCalculateBits(t *testing.T) {
+	blocks := blockchain.RetargetInterval - 1
+	expected := int64(blockchain.TargetBlockTime * blocks)
+
+	cases := []struct {
+		name   string
+		actual int64
+		want   int
+	}{
+		{"on target", expected, 18},
+		{"twice as fast", expected / 2, 19},
+		{"twice as slow", expected * 2, 17},
+		{"clamped fast", 0, 20},
+		{"clamped slow", expected * 100, 16},
+	}
+
+	for _, c := range cases {
+		if got := blockchain.CalculateBits(18, c.actual, blocks); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, got, c.want)
+		}
+	}
+
+	if got := blockchain.CalculateBits(blockchain.MinDifficulty, expected*4, blocks); got != blockchain.MinDifficulty {
+		t.Errorf("difficulty dropped below minimum: %d", got)
+	}
+}
+
+// TestBlockTimestamp - это функция, которая проверяет, что время блока должно быть больше медианного времени
+// последних блоков и не может сильно опережать часы узла.
+func TestBlockTimestamp(t *testing.T) {
+	owner := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, owner, blockchain.MedianTimeSpan)
+	miner := string(owner.VersionedAddress(config.RegTest.AddressVersion))
+
+	tip, err := chain.GetBlock(chain.LastHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	median, err := chain.MedianTimePast(&tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sealed - это функция, которая запечатывает блок после tip со временем timestamp.
+	sealed := func(timestamp int64) *blockchain.Block {
+		coinbase, err := blockchain.NewCoinbaseTx(chain.Params, miner, "", chain.Subsidy(tip.Height+1), tip.Height+1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := blockchain.NewBlock([]*blockchain.Transaction{coinbase}, tip.Hash, tip.Height+1, 0)
+		block.Timestamp = timestamp
+		if err := chain.Engine.Seal(context.Background(), chain, block); err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+
+	cases := []struct {
+		name      string
+		timestamp int64
+		want      error
+	}{
+		{"median", median, blockchain.ErrTimeTooOld},
+		{"before median", median - 100, blockchain.ErrTimeTooOld},
+		{"far future", time.Now().Unix() + blockchain.MaxFutureBlockTime + 60, blockchain.ErrTimeTooNew},
+	}
+	for _, c := range cases {
+		if err := chain.AcceptBlock(sealed(c.timestamp)); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	if err := chain.AcceptBlock(sealed(median + 1)); err != nil {
+		t.Errorf("Block after median rejected: %v", err)
+	}
+}
+
+// TestCheckOrphanHeader - это функция, которая проверяет, что блок с неизвестным родителем откладывается,
+// только если он запечатан со сложностью не ниже той, до которой могла упасть сложность основной цепочки.
+func TestCheckOrphanHeader(t *testing.T) {
+	engine := blockchain.NewPoWEngine()
+	chain, err := blockchain.InitBlockChainWithStore(storage.NewMemoryStore(), &config.RegTest, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	miner := string(newWallet(t).VersionedAddress(config.RegTest.AddressVersion))
+
+	// orphan - это функция, которая запечатывает блок на высоте 5 после неизвестного родителя со сложностью bits.
+	orphan := func(bits int) *blockchain.Block {
+		coinbase, err := blockchain.NewCoinbaseTx(chain.Params, miner, "", chain.Subsidy(5), 5, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := blockchain.NewBlock([]*blockchain.Transaction{coinbase}, []byte("unknown parent"), 5, 0)
+		block.Bits = bits
+		if err := engine.Seal(context.Background(), chain, block); err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+
+	if err := chain.CheckOrphanHeader(orphan(config.RegTest.Difficulty)); err != nil {
+		t.Errorf("Sealed orphan rejected: %v", err)
+	}
+	if err := chain.CheckOrphanHeader(orphan(0)); !errors.Is(err, blockchain.ErrInvalidProof) {
+		t.Errorf("Orphan without work: got %v, want %v", err, blockchain.ErrInvalidProof)
+	}
+	forged := orphan(config.RegTest.Difficulty)
+	forged.Nonce++
+	if err := chain.CheckOrphanHeader(forged); !errors.Is(err, blockchain.ErrBadBlockHash) {
+		t.Errorf("Forged orphan: got %v, want %v", err, blockchain.ErrBadBlockHash)
+	}
+}
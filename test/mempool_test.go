@@ -0,0 +1,203 @@
+package wallet_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+	wallet "github.com/fenix1851/golang-blockchain/wallet"
+)
+
+// newTestMempool - это функция, которая создает мемпул блокчейна и останавливает тест при ошибке.
+func newTestMempool(t *testing.T, chain *blockchain.BlockChain) *blockchain.Mempool {
+	t.Helper()
+	pool, err := blockchain.NewMempool(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// newPoolTx - это функция, которая создает транзакцию на amount с фиксированной комиссией fee.
+func newPoolTx(t *testing.T, UTXOSet *blockchain.UTXOSet, from *wallet.Wallet, amount, fee int) *blockchain.Transaction {
+	t.Helper()
+	to := string(newWallet(t).VersionedAddress(config.RegTest.AddressVersion))
+	tx, err := blockchain.NewTransaction(from, to, amount, blockchain.FeePolicy{Fixed: fee}, UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// TestMempoolCorruptRecord - это функция, которая проверяет, что испорченная запись мемпула в базе данных
+// возвращает ошибку при загрузке мемпула, а не роняет узел.
+func TestMempoolCorruptRecord(t *testing.T) {
+	chain := newMinerChain(t, &config.RegTest, newWallet(t), 1)
+	if err := chain.Database.Put([]byte("mempool-bad"), []byte{0x7f, 0xff, 0x81, 0x03, 0x01, 0x01, 0x05}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blockchain.NewMempool(chain); !errors.Is(err, blockchain.ErrCorruptData) {
+		t.Errorf("got %v, want %v", err, blockchain.ErrCorruptData)
+	}
+}
+
+// TestMempoolRejectsBadValue - это функция, которая проверяет, что мемпул не принимает транзакцию с отрицательным выходом.
+func TestMempoolRejectsBadValue(t *testing.T) {
+	owner := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity)
+	pool := newTestMempool(t, chain)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	tx := newPoolTx(t, &UTXOSet, owner, 10, 1)
+	tx.Outputs[0].Value = -1000
+	if err := chain.SignTransaction(tx, owner.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pool.Add(tx); !errors.Is(err, blockchain.ErrBadValue) {
+		t.Errorf("got %v, want %v", err, blockchain.ErrBadValue)
+	}
+	if pool.Count() != 0 {
+		t.Error("Transaction with a negative output is in the mempool")
+	}
+}
+
+// TestMempoolSpendableOutputs - это функция, которая проверяет, что выходы, потраченные в мемпуле,
+// не выбираются снова и вторая отправка не конфликтует с первой.
+func TestMempoolSpendableOutputs(t *testing.T) {
+	owner := newWallet(t)
+	// Созревают coinbase двух первых блоков, их хватит на две отправки.
+	chain := newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity+1)
+	pool := newTestMempool(t, chain)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain, Mempool: pool}
+
+	for i := 0; i < 2; i++ {
+		if err := pool.Add(newPoolTx(t, &UTXOSet, owner, 10, 1)); err != nil {
+			t.Fatalf("Send %d: %v", i+1, err)
+		}
+	}
+	if pool.Count() != 2 {
+		t.Errorf("Mempool has %d transactions, want 2", pool.Count())
+	}
+}
+
+// TestBlockTemplateDropsInvalid - это функция, которая проверяет, что шаблон блока не берет транзакцию,
+// выходы которой уже потратил блок, и удаляет ее из мемпула.
+func TestBlockTemplateDropsInvalid(t *testing.T) {
+	owner := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity)
+	pool := newTestMempool(t, chain)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	pooled := newPoolTx(t, &UTXOSet, owner, 10, 1)
+	mined := newPoolTx(t, &UTXOSet, owner, 20, 1)
+	if err := pool.Add(pooled); err != nil {
+		t.Fatal(err)
+	}
+	// Блок тратит те же выходы, но приходит в обход мемпула.
+	miner := string(owner.VersionedAddress(config.RegTest.AddressVersion))
+	if _, err := chain.MineBlock(miner, []*blockchain.Transaction{mined}); err != nil {
+		t.Fatal(err)
+	}
+
+	txs, err := pool.BlockTemplate(blockchain.MaxBlockTxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 0 {
+		t.Errorf("Template has %d transactions, want 0", len(txs))
+	}
+	if pool.Contains(pooled.ID) {
+		t.Error("Invalid transaction is still in the mempool")
+	}
+	if _, err := chain.MineBlock(miner, txs); err != nil {
+		t.Errorf("Block from the template is invalid: %v", err)
+	}
+}
+
+// TestMempoolConflict - это функция, которая проверяет, что мемпул не принимает вторую транзакцию,
+// тратящую тот же выход.
+func TestMempoolConflict(t *testing.T) {
+	owner := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity)
+	pool := newTestMempool(t, chain)
+	// Без мемпула UTXOSet дважды выберет один и тот же выход.
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	if err := pool.Add(newPoolTx(t, &UTXOSet, owner, 10, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Add(newPoolTx(t, &UTXOSet, owner, 20, 1)); !errors.Is(err, blockchain.ErrMempoolConflict) {
+		t.Errorf("got %v, want %v", err, blockchain.ErrMempoolConflict)
+	}
+}
+
+// TestMempoolEviction - это функция, которая проверяет, что в полном мемпуле транзакция с большей комиссией за байт
+// вытесняет транзакцию с меньшей, а транзакция с меньшей комиссией отклоняется.
+func TestMempoolEviction(t *testing.T) {
+	owner := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity+2)
+	pool := newTestMempool(t, chain)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain, Mempool: pool}
+
+	cheap := newPoolTx(t, &UTXOSet, owner, 10, 1)
+	// В мемпул помещается только одна транзакция.
+	pool.MaxSize = len(cheap.Serialize()) + 10
+	if err := pool.Add(cheap); err != nil {
+		t.Fatal(err)
+	}
+
+	rich := newPoolTx(t, &UTXOSet, owner, 10, 50)
+	if err := pool.Add(rich); err != nil {
+		t.Fatalf("Transaction with a higher fee rate rejected: %v", err)
+	}
+	if pool.Contains(cheap.ID) || !pool.Contains(rich.ID) {
+		t.Error("Transaction with the lower fee rate was not evicted")
+	}
+
+	if err := pool.Add(newPoolTx(t, &UTXOSet, owner, 10, 1)); !errors.Is(err, blockchain.ErrMempoolFull) {
+		t.Errorf("got %v, want %v", err, blockchain.ErrMempoolFull)
+	}
+}
+
+// TestBlockTemplateOrder - это функция, которая проверяет, что шаблон блока берет транзакции
+// от большей комиссии за байт к меньшей и не превышает заданный размер.
+func TestBlockTemplateOrder(t *testing.T) {
+	owner := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity+2)
+	pool := newTestMempool(t, chain)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain, Mempool: pool}
+
+	var txs []*blockchain.Transaction
+	for _, fee := range []int{1, 9, 5} {
+		tx := newPoolTx(t, &UTXOSet, owner, 10, fee)
+		if err := pool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	template, err := pool.BlockTemplate(blockchain.MaxBlockTxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*blockchain.Transaction{txs[1], txs[2], txs[0]}
+	if len(template) != len(want) {
+		t.Fatalf("Template has %d transactions, want %d", len(template), len(want))
+	}
+	for i := range want {
+		if string(template[i].ID) != string(want[i].ID) {
+			t.Errorf("Position %d: got %x, want %x", i, template[i].ID, want[i].ID)
+		}
+	}
+
+	// В шаблон размером с одну транзакцию попадает только транзакция с наибольшей комиссией.
+	small, err := pool.BlockTemplate(len(txs[1].Serialize()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(small) != 1 || string(small[0].ID) != string(txs[1].ID) {
+		t.Errorf("Small template has %d transactions, want only the richest one", len(small))
+	}
+}
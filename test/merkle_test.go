@@ -0,0 +1,39 @@
+package wallet_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+)
+
+// TestMerkleProof - это функция, которая проверяет доказательства включения для блоков разного размера.
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 7; n++ {
+		block := &blockchain.Block{}
+		for i := 0; i < n; i++ {
+			tx := coinbaseTx(t, "1HT7xU2Ngenf7D4yocz2SAcnNLW7rK8d4E", fmt.Sprintf("tx %d", i))
+			block.Transactions = append(block.Transactions, tx)
+		}
+		root := block.HashTransactions()
+
+		for _, tx := range block.Transactions {
+			proof, err := block.MerkleProof(tx.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !blockchain.VerifyMerkleProof(root, tx.ID, proof) {
+				t.Errorf("%d transactions: valid proof rejected", n)
+			}
+			if blockchain.VerifyMerkleProof(root, []byte("other"), proof) {
+				t.Errorf("%d transactions: proof accepted for a foreign ID", n)
+			}
+		}
+	}
+
+	block := &blockchain.Block{}
+	if _, err := block.MerkleProof([]byte("missing")); !errors.Is(err, blockchain.ErrTxNotInBlock) {
+		t.Errorf("Missing transaction: got %v, want %v", err, blockchain.ErrTxNotInBlock)
+	}
+}
@@ -0,0 +1,123 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+	"github.com/fenix1851/golang-blockchain/storage"
+)
+
+// newMinerBlock - это функция, которая создает блок с coinbase для майнинга в тестах.
+func newMinerBlock(t *testing.T, bits int) *blockchain.Block {
+	t.Helper()
+	miner := string(newWallet(t).Address())
+	coinbase, err := blockchain.NewCoinbaseTx(&config.MainNet, miner, "", config.MainNet.Reward, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blockchain.NewBlock([]*blockchain.Transaction{coinbase}, []byte("prev"), 1, bits)
+}
+
+// TestMinerMine - это функция, которая проверяет, что параллельный майнер находит действительный nonce.
+func TestMinerMine(t *testing.T) {
+	block := newMinerBlock(t, 8)
+	m := blockchain.NewMiner()
+	m.Workers = 4
+
+	if err := m.Mine(context.Background(), block); err != nil {
+		t.Fatal(err)
+	}
+	if !blockchain.NewProof(block).Validate() {
+		t.Error("Mined block has invalid proof of work")
+	}
+}
+
+// TestMinerCancel - это функция, которая проверяет, что майнинг останавливается при отмене контекста.
+func TestMinerCancel(t *testing.T) {
+	block := newMinerBlock(t, blockchain.MaxDifficulty)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := blockchain.NewMiner().Mine(ctx, block); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+// TestMinerRollsExtraNonce - это функция, которая проверяет смену extra-nonce, когда nonce перебраны.
+func TestMinerRollsExtraNonce(t *testing.T) {
+	block := newMinerBlock(t, 12)
+	root := string(block.MerkleRoot)
+	m := blockchain.NewMiner()
+	m.Workers = 2
+	m.MaxNonce = 15
+
+	if err := m.Mine(context.Background(), block); err != nil {
+		t.Fatal(err)
+	}
+	if string(block.MerkleRoot) == root {
+		t.Error("Extra-nonce was not rolled")
+	}
+	if err := blockchain.CheckBlockSanity(block); err != nil {
+		t.Errorf("Block with rolled extra-nonce is invalid: %v", err)
+	}
+	if !blockchain.NewProof(block).Validate() {
+		t.Error("Mined block has invalid proof of work")
+	}
+}
+
+// TestProofBitsOutOfRange - это функция, которая проверяет, что сложность вне границ не ломает проверку работы.
+func TestProofBitsOutOfRange(t *testing.T) {
+	for _, bits := range []int{-1, blockchain.MaxDifficulty + 1, 300} {
+		block := newMinerBlock(t, 0)
+		block.Bits = bits
+		if blockchain.NewProof(block).Validate() {
+			t.Errorf("Block with bits %d passed proof of work", bits)
+		}
+	}
+}
+
+// waitingEngine - это механизм мгновенной печати, который запечатывает блок только после отмены ctx.
+// Через started он сообщает, что запечатывание началось.
+type waitingEngine struct {
+	blockchain.InstantSealEngine
+	started chan struct{}
+}
+
+// Seal - это функция, которая ждет отмены ctx и возвращает ее ошибку.
+func (e waitingEngine) Seal(ctx context.Context, chain *blockchain.BlockChain, block *blockchain.Block) error {
+	close(e.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// TestMiningStopsOnNewTip - это функция, которая проверяет, что майнинг прерывается, когда приходит конкурирующий блок.
+func TestMiningStopsOnNewTip(t *testing.T) {
+	engine := waitingEngine{started: make(chan struct{})}
+	chain, err := blockchain.InitBlockChainWithStore(storage.NewMemoryStore(), &config.RegTest, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	miner := string(newWallet(t).VersionedAddress(config.RegTest.AddressVersion))
+	other := string(newWallet(t).VersionedAddress(config.RegTest.AddressVersion))
+	rival, err := newTestChain(t, &config.RegTest, 0).MineBlock(other, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := chain.MineBlockContext(context.Background(), miner, nil)
+		done <- err
+	}()
+
+	<-engine.started
+	if err := chain.AcceptBlock(rival); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, blockchain.ErrTipChanged) {
+		t.Errorf("Mining over a stale tip: got %v, want %v", err, blockchain.ErrTipChanged)
+	}
+}
@@ -0,0 +1,541 @@
+package wallet_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+	"github.com/fenix1851/golang-blockchain/network"
+	"github.com/fenix1851/golang-blockchain/storage"
+	wallet "github.com/fenix1851/golang-blockchain/wallet"
+)
+
+// newTestChain - это функция, которая создает блокчейн в памяти сети params с blocks блоками после генезиса.
+func newTestChain(t *testing.T, params *config.ChainParams, blocks int) *blockchain.BlockChain {
+	t.Helper()
+	return newMinerChain(t, params, newWallet(t), blocks)
+}
+
+// newMinerChain - это функция, которая создает блокчейн в памяти, все награды в котором получает кошелек w.
+func newMinerChain(t *testing.T, params *config.ChainParams, w *wallet.Wallet, blocks int) *blockchain.BlockChain {
+	t.Helper()
+	miner := string(w.VersionedAddress(params.AddressVersion))
+	chain, err := blockchain.InitBlockChainWithStore(storage.NewMemoryStore(), params, blockchain.InstantSealEngine{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < blocks; i++ {
+		if _, err := chain.MineBlock(miner, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chain
+}
+
+// newEmptyChain - это функция, которая создает пустой блокчейн в памяти сети params, который ждет блоки от участников.
+func newEmptyChain(t *testing.T, params *config.ChainParams) *blockchain.BlockChain {
+	t.Helper()
+	chain, err := blockchain.OpenBlockChainWithStore(storage.NewMemoryStore(), params, blockchain.InstantSealEngine{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+// newTestServer - это функция, которая создает узел сети params на свободном порту.
+// Сам узел ни к кому не подключается, соединения задает тест.
+func newTestServer(t *testing.T, params *config.ChainParams, chain *blockchain.BlockChain) *network.Server {
+	t.Helper()
+	server := network.NewServer(config.New(t.TempDir(), params), chain, "127.0.0.1:0")
+	server.TargetOutbound = 0
+	return server
+}
+
+// startTestServer - это функция, которая запускает узел, созданный newTestServer.
+func startTestServer(t *testing.T, params *config.ChainParams, chain *blockchain.BlockChain) *network.Server {
+	t.Helper()
+	return start(t, newTestServer(t, params, chain))
+}
+
+// start - это функция, которая запускает узел и останавливает его в конце теста.
+func start(t *testing.T, server *network.Server) *network.Server {
+	t.Helper()
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	return server
+}
+
+// waitFor - это функция, которая ждет выполнения условия не дольше пяти секунд.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestMessageRoundTrip - это функция, которая проверяет кодирование сообщения и отказ в чужом magic и испорченных данных.
+func TestMessageRoundTrip(t *testing.T) {
+	m, err := network.EncodeMessage(network.CmdVersion, network.Version{Version: 1, BestHeight: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err := network.WriteMessage(&buffer, config.RegTest.Magic, m); err != nil {
+		t.Fatal(err)
+	}
+	raw := buffer.Bytes()
+
+	got, err := network.ReadMessage(bytes.NewReader(raw), config.RegTest.Magic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var version network.Version
+	if err := got.Decode(&version); err != nil || got.Command != network.CmdVersion || version.BestHeight != 7 {
+		t.Errorf("Decoded %s %+v, %v", got.Command, version, err)
+	}
+
+	if _, err := network.ReadMessage(bytes.NewReader(raw), config.MainNet.Magic); !errors.Is(err, network.ErrBadMagic) {
+		t.Errorf("Foreign magic: got %v, want %v", err, network.ErrBadMagic)
+	}
+	corrupted := append([]byte{}, raw...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	if _, err := network.ReadMessage(bytes.NewReader(corrupted), config.RegTest.Magic); !errors.Is(err, network.ErrBadChecksum) {
+		t.Errorf("Corrupted payload: got %v, want %v", err, network.ErrBadChecksum)
+	}
+}
+
+// TestHandshake - это функция, которая проверяет, что узлы обмениваются высотами и отслеживают друг друга,
+// а узел другой сети и соединение с самим собой отклоняются.
+func TestHandshake(t *testing.T) {
+	a := startTestServer(t, &config.RegTest, newTestChain(t, &config.RegTest, 2))
+	// У второго узла блокчейна нет: узел с другим генезис-блоком отключился бы при синхронизации.
+	b := startTestServer(t, &config.RegTest, newEmptyChain(t, &config.RegTest))
+
+	peer, err := b.Connect(a.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.BestHeight() != 2 || peer.Version != network.ProtocolVersion {
+		t.Errorf("Peer height %d, version %d", peer.BestHeight(), peer.Version)
+	}
+	waitFor(t, "inbound peer", func() bool { return len(a.Peers()) == 1 })
+	if inbound := a.Peers()[0]; !inbound.Inbound || inbound.BestHeight() != 0 || inbound.ListenAddr != b.Addr().String() {
+		t.Errorf("Inbound peer %s: height %d, listen address %q", inbound, inbound.BestHeight(), inbound.ListenAddr)
+	}
+
+	if _, err := b.Connect(a.Addr().String()); !errors.Is(err, network.ErrDuplicatePeer) {
+		t.Errorf("Second connection: got %v, want %v", err, network.ErrDuplicatePeer)
+	}
+	if _, err := a.Connect(a.Addr().String()); !errors.Is(err, network.ErrSelfConnect) {
+		t.Errorf("Self connection: got %v, want %v", err, network.ErrSelfConnect)
+	}
+
+	other := startTestServer(t, &config.TestNet, newTestChain(t, &config.TestNet, 0))
+	if _, err := other.Connect(a.Addr().String()); err == nil {
+		t.Error("Node of another network connected")
+	}
+
+	b.Stop()
+	waitFor(t, "disconnect", func() bool { return len(a.Peers()) == 0 })
+}
+
+// TestBlockLocator - это функция, которая проверяет, что по локатору короткой цепочки длинная находит
+// недостающие блоки, начиная со следующего после общего.
+func TestBlockLocator(t *testing.T) {
+	chain := newTestChain(t, &config.RegTest, 30)
+	locator, err := chain.BlockLocator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10 блоков подряд, затем шаг 2, 4, 8, 16 и генезис-блок.
+	if len(locator) != 14 || !bytes.Equal(locator[0], chain.LastHash()) {
+		t.Errorf("Locator has %d hashes", len(locator))
+	}
+
+	hashes, err := chain.BlockHashesAfter(locator[5:], 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 {
+		t.Fatalf("Got %d hashes, want 3", len(hashes))
+	}
+	if block, err := chain.GetBlock(hashes[0]); err != nil || block.Height != 26 {
+		t.Errorf("First hash after the locator is not block 26: %v", err)
+	}
+	if hashes, err := chain.BlockHashesAfter(nil, 100); err != nil || len(hashes) != 31 {
+		t.Errorf("Empty locator: %d hashes, %v, want 31", len(hashes), err)
+	}
+}
+
+// TestBlockSync - это функция, которая проверяет, что узел без блокчейна скачивает его у участника,
+// а следующий узел - параллельно у двух участников.
+func TestBlockSync(t *testing.T) {
+	source := newTestChain(t, &config.RegTest, 40)
+	a := startTestServer(t, &config.RegTest, source)
+
+	synced := func(s *network.Server) func() bool {
+		return func() bool {
+			height, err := s.BestHeight()
+			return err == nil && height == 40
+		}
+	}
+
+	bChain := newEmptyChain(t, &config.RegTest)
+	b := startTestServer(t, &config.RegTest, bChain)
+	if _, err := b.Connect(a.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "second node sync", synced(b))
+	if !bytes.Equal(bChain.LastHash(), source.LastHash()) {
+		t.Error("Second node has another last block")
+	}
+
+	cChain := newEmptyChain(t, &config.RegTest)
+	c := startTestServer(t, &config.RegTest, cChain)
+	var mu sync.Mutex
+	progress := 0
+	c.OnProgress = func(height, target int) {
+		mu.Lock()
+		if height > progress {
+			progress = height
+		}
+		mu.Unlock()
+	}
+	for _, server := range []*network.Server{a, b} {
+		if _, err := c.Connect(server.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "third node sync", synced(c))
+	if !bytes.Equal(cChain.LastHash(), source.LastHash()) {
+		t.Error("Third node has another last block")
+	}
+	waitFor(t, "sync progress", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return progress == 40
+	})
+}
+
+// TestTxRelay - это функция, которая проверяет, что транзакция, отправленная на один узел, доходит по цепочке
+// узлов до остальных и до нового узла после его синхронизации, а повторная отправка той же транзакции отклоняется.
+func TestTxRelay(t *testing.T) {
+	owner := newWallet(t)
+	source := newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity)
+	UTXOSet := blockchain.UTXOSet{Blockchain: source}
+	to := string(newWallet(t).VersionedAddress(config.RegTest.AddressVersion))
+	tx, err := blockchain.NewTransaction(owner, to, 10, blockchain.FeePolicy{Fixed: 1}, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Узлы соединены цепочкой a - b - c, так что до c транзакция доходит только через b.
+	a := startTestServer(t, &config.RegTest, source)
+	b := startTestServer(t, &config.RegTest, newEmptyChain(t, &config.RegTest))
+	c := startTestServer(t, &config.RegTest, newEmptyChain(t, &config.RegTest))
+	if _, err := b.Connect(a.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Connect(b.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	for _, server := range []*network.Server{b, c} {
+		server := server
+		waitFor(t, "sync", func() bool {
+			height, err := server.BestHeight()
+			return err == nil && height == config.RegTest.CoinbaseMaturity
+		})
+	}
+
+	if err := a.SubmitTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "relay", func() bool { return c.Mempool().Contains(tx.ID) })
+	if !b.Mempool().Contains(tx.ID) {
+		t.Error("Middle node does not have the transaction")
+	}
+	if err := c.SubmitTransaction(tx); !errors.Is(err, blockchain.ErrMempoolExists) {
+		t.Errorf("Second submit: got %v, want %v", err, blockchain.ErrMempoolExists)
+	}
+
+	// Новый узел получает транзакцию, когда догонит блокчейн: раньше ее входы ему неизвестны.
+	d := startTestServer(t, &config.RegTest, newEmptyChain(t, &config.RegTest))
+	if _, err := d.Connect(a.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "relay after sync", func() bool { return d.Mempool().Contains(tx.ID) })
+}
+
+// TestClientSubmit - это функция, которая проверяет, что клиент без своей копии блокчейна получает у узла выходы,
+// отправляет ему подписанную транзакцию и узнает, что узел ее не принял.
+func TestClientSubmit(t *testing.T) {
+	owner := newWallet(t)
+	server := startTestServer(t, &config.RegTest, newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity+1))
+	to := string(newWallet(t).VersionedAddress(config.RegTest.AddressVersion))
+
+	client, err := network.Dial(&config.RegTest, server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	outs, err := client.SpendableOutputs(wallet.PublicKeyHash(owner.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Созрели coinbase двух первых блоков.
+	if len(outs) != 2 {
+		t.Fatalf("Node returned %d outputs, want 2", len(outs))
+	}
+	tx, err := blockchain.NewTransactionFromOutputs(owner, to, 10, blockchain.FeePolicy{Fixed: 1}, &config.RegTest, outs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SubmitTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if !server.Mempool().Contains(tx.ID) {
+		t.Error("Submitted transaction is not in the mempool")
+	}
+
+	// Выход, потраченный мемпулом, узел больше не отдает, а транзакция с ним конфликтует.
+	if left, err := client.SpendableOutputs(wallet.PublicKeyHash(owner.PublicKey)); err != nil || len(left) != 1 {
+		t.Errorf("Node returned %d outputs (%v) after the send, want 1", len(left), err)
+	}
+	conflict, err := blockchain.NewTransactionFromOutputs(owner, to, 20, blockchain.FeePolicy{Fixed: 1}, &config.RegTest, outs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SubmitTransaction(conflict); !errors.Is(err, network.ErrTxNotAccepted) {
+		t.Errorf("Conflicting transaction: got %v, want %v", err, network.ErrTxNotAccepted)
+	}
+}
+
+// TestAddrBook - это функция, которая проверяет адресную книгу: время последнего контакта, выбор адресов
+// для подключения, удаление после неудачных подключений и сохранение в файл.
+func TestAddrBook(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "peers.data")
+	book := network.NewAddrBook(file)
+	now := time.Now()
+	if !book.Add("10.0.0.1:3000", now.Add(-time.Hour)) || !book.Add("10.0.0.2:3000", now) {
+		t.Fatal("Valid address rejected")
+	}
+	for _, bad := range []string{"10.0.0.3", ":3000", "10.0.0.3:0", "10.0.0.3:port"} {
+		if book.Add(bad, now) {
+			t.Errorf("Invalid address %q accepted", bad)
+		}
+	}
+	// Старое время контакта не заменяет более новое.
+	book.Add("10.0.0.2:3000", now.Add(-2*time.Hour))
+
+	addrs := book.Addresses(10)
+	if len(addrs) != 2 || addrs[0].Addr != "10.0.0.2:3000" || addrs[0].LastSeen != now.Unix() {
+		t.Fatalf("Addresses %+v", addrs)
+	}
+	candidates := book.Candidates(10, map[string]bool{"10.0.0.2:3000": true})
+	if len(candidates) != 1 || candidates[0] != "10.0.0.1:3000" {
+		t.Errorf("Candidates %v", candidates)
+	}
+	// После неудачного подключения адрес выбирается только после задержки.
+	book.Attempt("10.0.0.1:3000")
+	book.Failed("10.0.0.1:3000")
+	if candidates := book.Candidates(10, nil); len(candidates) != 1 || candidates[0] != "10.0.0.2:3000" {
+		t.Errorf("Candidates after a failure %v", candidates)
+	}
+
+	if err := book.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := network.NewAddrBook(file)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Addresses(10); len(got) != 2 || got[0] != addrs[0] || got[1].Failures != 1 {
+		t.Errorf("Loaded addresses %+v", got)
+	}
+}
+
+// TestPeerDiscovery - это функция, которая проверяет, что узел, знающий только seed-узел, узнает от него
+// адреса остальных узлов, подключается к ним и запоминает их в адресной книге.
+func TestPeerDiscovery(t *testing.T) {
+	seed := startTestServer(t, &config.RegTest, newTestChain(t, &config.RegTest, 0))
+	other := startTestServer(t, &config.RegTest, newEmptyChain(t, &config.RegTest))
+	if _, err := other.Connect(seed.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "seed to learn the address", func() bool { return seed.AddrBook().Len() == 1 })
+
+	cfg := config.New(t.TempDir(), &config.RegTest)
+	cfg.Seeds = []string{seed.Addr().String()}
+	node := network.NewServer(cfg, newEmptyChain(t, &config.RegTest), "127.0.0.1:0")
+	node.TargetOutbound = 2
+	start(t, node)
+
+	connected := func(addr string) bool {
+		for _, peer := range node.Peers() {
+			if !peer.Inbound && peer.Addr == addr {
+				return true
+			}
+		}
+		return false
+	}
+	waitFor(t, "connection to the seed", func() bool { return connected(seed.Addr().String()) })
+	waitFor(t, "connection to the discovered node", func() bool { return connected(other.Addr().String()) })
+
+	node.Stop()
+	book := network.NewAddrBook(cfg.PeersFile)
+	if err := book.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if addrs := book.Addresses(10); len(addrs) != 2 || addrs[0].LastSeen == 0 {
+		t.Errorf("Saved address book %+v", addrs)
+	}
+}
+
+// TestDecodeGarbage - это функция, которая проверяет, что испорченные данные от участника возвращают ошибку,
+// а не роняют узел.
+func TestDecodeGarbage(t *testing.T) {
+	garbage := [][]byte{nil, []byte("garbage"), {0x7f, 0xff, 0x81, 0x03, 0x01, 0x01, 0x05}, bytes.Repeat([]byte{0xff}, 64)}
+	for _, data := range garbage {
+		if _, err := blockchain.Deserialize(data); !errors.Is(err, blockchain.ErrCorruptData) {
+			t.Errorf("Block %x: got %v, want %v", data, err, blockchain.ErrCorruptData)
+		}
+		if _, err := blockchain.DeserializeTransaction(data); !errors.Is(err, blockchain.ErrCorruptData) {
+			t.Errorf("Transaction %x: got %v, want %v", data, err, blockchain.ErrCorruptData)
+		}
+		if _, err := blockchain.DeserializeOutputs(data); !errors.Is(err, blockchain.ErrCorruptData) {
+			t.Errorf("Outputs %x: got %v, want %v", data, err, blockchain.ErrCorruptData)
+		}
+		m := &network.Message{Command: network.CmdInv, Payload: data}
+		var inv network.Inv
+		if err := m.Decode(&inv); !errors.Is(err, network.ErrBadPayload) {
+			t.Errorf("Message %x: got %v, want %v", data, err, network.ErrBadPayload)
+		}
+	}
+
+	// Блок с пустой транзакцией отклоняется проверкой, а не паникой.
+	block := &blockchain.Block{Transactions: []*blockchain.Transaction{nil}}
+	block.Version = blockchain.BlockVersion
+	if err := blockchain.CheckBlockSanity(block); !errors.Is(err, blockchain.ErrBadTransaction) {
+		t.Errorf("Block with a nil transaction: got %v, want %v", err, blockchain.ErrBadTransaction)
+	}
+}
+
+// TestMisbehaviourBan - это функция, которая проверяет, что участник получает штраф за испорченные сообщения,
+// набрав BanThreshold, отключается, а блокировка не дает ему подключиться снова и сохраняется в файл.
+func TestMisbehaviourBan(t *testing.T) {
+	cfg := config.New(t.TempDir(), &config.RegTest)
+	a := network.NewServer(cfg, newTestChain(t, &config.RegTest, 2), "127.0.0.1:0")
+	a.TargetOutbound = 0
+	start(t, a)
+	b := startTestServer(t, &config.RegTest, newEmptyChain(t, &config.RegTest))
+
+	peer, err := b.Connect(a.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "inbound peer", func() bool { return len(a.Peers()) == 1 })
+	if err := peer.Send(network.CmdTx, network.Tx{Data: []byte("garbage")}); err != nil {
+		t.Fatal(err)
+	}
+	// После первого нарушения участник остается подключенным.
+	waitFor(t, "misbehaviour score", func() bool { return len(a.Peers()) == 1 && a.Peers()[0].Score() > 0 })
+	if score := a.Peers()[0].Score(); score >= network.BanThreshold {
+		t.Fatalf("Score %d after one malformed message", score)
+	}
+
+	for len(a.Peers()) > 0 {
+		if err := peer.Send(network.CmdBlock, network.Block{Data: []byte("garbage")}); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitFor(t, "ban", func() bool { return len(a.Peers()) == 0 })
+	if !a.BanList().IsBanned("127.0.0.1") {
+		t.Fatalf("Banned hosts %v", a.BanList().Hosts())
+	}
+	if _, err := b.Connect(a.Addr().String()); err == nil {
+		t.Error("Banned node connected again")
+	}
+
+	a.Stop()
+	bans := network.NewBanList(cfg.BansFile)
+	if err := bans.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := bans.Hosts(); len(hosts) != 1 || hosts[0] != "127.0.0.1" {
+		t.Errorf("Saved ban list %v", hosts)
+	}
+	bans.Ban("10.0.0.1", time.Now().Add(-time.Second))
+	if bans.IsBanned("10.0.0.1") {
+		t.Error("Expired ban is in force")
+	}
+}
+
+// TestHandshakeBan - это функция, которая проверяет, что нарушение протокола при рукопожатии штрафуется
+// и штраф адреса переживает переподключение: узел из чужой сети блокируется после нескольких попыток.
+func TestHandshakeBan(t *testing.T) {
+	a := startTestServer(t, &config.RegTest, newTestChain(t, &config.RegTest, 1))
+
+	// attempt - это функция, которая подключается к a, отправляет version чужой сети и ждет, пока a закроет соединение.
+	attempt := func() {
+		conn, err := net.Dial("tcp", a.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		m, err := network.EncodeMessage(network.CmdVersion, network.Version{Version: network.ProtocolVersion})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := network.WriteMessage(conn, config.MainNet.Magic, m); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		io.Copy(io.Discard, conn)
+	}
+
+	attempt()
+	if a.BanList().IsBanned("127.0.0.1") {
+		t.Fatal("Banned after one foreign handshake")
+	}
+	attempt()
+	if !a.BanList().IsBanned("127.0.0.1") {
+		t.Errorf("Not banned after reconnecting with a foreign handshake, banned hosts %v", a.BanList().Hosts())
+	}
+}
+
+// TestInvalidBlockBan - это функция, которая проверяет, что за недействительный блок участник блокируется сразу.
+func TestInvalidBlockBan(t *testing.T) {
+	a := startTestServer(t, &config.RegTest, newTestChain(t, &config.RegTest, 1))
+	other := newTestChain(t, &config.RegTest, 1)
+	b := startTestServer(t, &config.RegTest, newEmptyChain(t, &config.RegTest))
+
+	block, err := other.GetBlock(other.LastHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.MerkleRoot = bytes.Repeat([]byte{1}, 32)
+
+	peer, err := b.Connect(a.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.Send(network.CmdBlock, network.Block{Data: block.Serialize()}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "ban", func() bool { return a.BanList().IsBanned("127.0.0.1") && len(a.Peers()) == 0 })
+}
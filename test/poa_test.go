@@ -0,0 +1,67 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+)
+
+// sealPoA - это функция, которая готовит и запечатывает блок механизмом доказательства полномочий.
+func sealPoA(t *testing.T, engine *blockchain.PoAEngine, block *blockchain.Block) {
+	t.Helper()
+	if err := engine.Prepare(nil, block); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Seal(context.Background(), nil, block); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPoAEngine - это функция, которая проверяет подписи блоков доказательства полномочий,
+// очередь подписантов и отказ блокам неизвестных подписантов.
+func TestPoAEngine(t *testing.T) {
+	a, b := newWallet(t), newWallet(t)
+	engine, err := blockchain.NewPoAEngine([][]byte{a.PublicKey, b.PublicKey}, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// newMinerBlock создает блок высоты 1, его очередь у второго подписанта.
+	block := newMinerBlock(t, config.MainNet.Difficulty)
+	sealPoA(t, engine, block)
+	if err := engine.VerifyHeader(nil, block); err != nil {
+		t.Fatalf("Sealed block rejected: %v", err)
+	}
+	if string(block.Signer) != string(b.PublicKey) {
+		t.Error("Block is not sealed by the in-turn signer")
+	}
+
+	// Узел без ключа подписанта, чья очередь, не может запечатать блок.
+	onlyA, _ := blockchain.NewPoAEngine([][]byte{a.PublicKey, b.PublicKey}, a)
+	if err := onlyA.Seal(context.Background(), nil, newMinerBlock(t, 0)); !errors.Is(err, blockchain.ErrSignerOutOfTurn) {
+		t.Errorf("Seal out of turn: got %v, want %v", err, blockchain.ErrSignerOutOfTurn)
+	}
+
+	// Тот же блок в другой очереди подписан не в свою очередь.
+	reversed, _ := blockchain.NewPoAEngine([][]byte{b.PublicKey, a.PublicKey})
+	if err := reversed.VerifyHeader(nil, block); !errors.Is(err, blockchain.ErrSignerOutOfTurn) {
+		t.Errorf("Out of turn: got %v, want %v", err, blockchain.ErrSignerOutOfTurn)
+	}
+
+	stranger, _ := blockchain.NewPoAEngine([][]byte{a.PublicKey})
+	if err := stranger.VerifyHeader(nil, block); !errors.Is(err, blockchain.ErrUnauthorizedSigner) {
+		t.Errorf("Unauthorised: got %v, want %v", err, blockchain.ErrUnauthorizedSigner)
+	}
+
+	block.Signature[0] ^= 0xff
+	if err := engine.VerifyHeader(nil, block); !errors.Is(err, blockchain.ErrBadSealSignature) {
+		t.Errorf("Bad signature: got %v, want %v", err, blockchain.ErrBadSealSignature)
+	}
+
+	if _, err := blockchain.NewPoAEngine(nil); !errors.Is(err, blockchain.ErrNoSigners) {
+		t.Errorf("No signers: got %v, want %v", err, blockchain.ErrNoSigners)
+	}
+}
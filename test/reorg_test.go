@@ -0,0 +1,148 @@
+package wallet_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+	wallet "github.com/fenix1851/golang-blockchain/wallet"
+)
+
+// forkBlock - это функция, которая запечатывает блок после parent, даже если parent не последний блок.
+// Coinbase блока платит reward на адрес miner.
+func forkBlock(t *testing.T, chain *blockchain.BlockChain, parent *blockchain.Block, miner string, reward int) *blockchain.Block {
+	t.Helper()
+	height := parent.Height + 1
+	coinbase, err := blockchain.NewCoinbaseTx(chain.Params, miner, "", reward, height, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := blockchain.NewBlock([]*blockchain.Transaction{coinbase}, parent.Hash, height, 0)
+	median, err := chain.MedianTimePast(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Timestamp <= median {
+		block.Timestamp = median + 1
+	}
+	if err := chain.Engine.Seal(context.Background(), chain, block); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+// mainBlock - это функция, которая возвращает блок основной цепочки на высоте height.
+func mainBlock(t *testing.T, chain *blockchain.BlockChain, height int) *blockchain.Block {
+	t.Helper()
+	block, err := chain.GetBlock(chain.LastHash())
+	for err == nil && block.Height > height {
+		block, err = chain.GetBlock(block.PrevHash)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &block
+}
+
+// utxoCount - это функция, которая возвращает число непотраченных выходов кошелька w.
+func utxoCount(t *testing.T, chain *blockchain.BlockChain, w *wallet.Wallet) int {
+	t.Helper()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	outs, err := UTXOSet.FindUTXO(wallet.PublicKeyHash(w.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(outs)
+}
+
+// TestReorganize - это функция, которая проверяет переход на более длинную ветку и UTXOSet после него.
+func TestReorganize(t *testing.T) {
+	alice := newWallet(t)
+	bob := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, alice, 2)
+	bobAddress := string(bob.VersionedAddress(config.RegTest.AddressVersion))
+	oldTip := chain.LastHash()
+	var logged []string
+	chain.Logf = func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+
+	parent := mainBlock(t, chain, 0)
+	for i := 0; i < 3; i++ {
+		parent = forkBlock(t, chain, parent, bobAddress, chain.Subsidy(parent.Height+1))
+		if err := chain.AcceptBlock(parent); err != nil {
+			t.Fatalf("Fork block %d: %v", i+1, err)
+		}
+	}
+
+	if !bytes.Equal(chain.LastHash(), parent.Hash) {
+		t.Fatal("Chain did not switch to the longer branch")
+	}
+	if height, err := chain.GetBestHeight(); err != nil || height != 3 {
+		t.Errorf("got height %d (%v), want 3", height, err)
+	}
+	// Выходы старой ветки Алисы откатаны.
+	if got := utxoCount(t, chain, alice); got != 0 {
+		t.Errorf("Alice has %d outputs, want 0", got)
+	}
+	if got := utxoCount(t, chain, bob); got != 3 {
+		t.Errorf("Bob has %d outputs, want 3", got)
+	}
+	// Индекс основной цепочки и локатор указывают на новую ветку.
+	if hash, err := chain.MainChainHash(3); err != nil || !bytes.Equal(hash, parent.Hash) {
+		t.Errorf("Main chain hash at height 3 is %x (%v), want the new tip", hash, err)
+	}
+	if hashes, err := chain.BlockHashesAfter([][]byte{oldTip, mainBlock(t, chain, 0).Hash}, 10); err != nil || len(hashes) != 3 {
+		t.Errorf("Hashes after the old tip: %d, %v, want the whole new branch", len(hashes), err)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "2 blocks detached, 3 attached") {
+		t.Errorf("Logged %q, want the reorganization", logged)
+	}
+}
+
+// TestReorganizeInvalidBranch - это функция, которая проверяет, что неудачный переход на ветку
+// возвращает прежний последний блок и UTXOSet, а ветка помечается недействительной.
+func TestReorganizeInvalidBranch(t *testing.T) {
+	alice := newWallet(t)
+	bob := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, alice, 2)
+	bobAddress := string(bob.VersionedAddress(config.RegTest.AddressVersion))
+	oldTip := chain.LastHash()
+
+	valid := forkBlock(t, chain, mainBlock(t, chain, 0), bobAddress, chain.Subsidy(1))
+	if err := chain.AcceptBlock(valid); err != nil {
+		t.Fatalf("Side branch block rejected: %v", err)
+	}
+	// Coinbase второго блока ветки платит больше награды, это видно только при переходе на ветку.
+	overpaid := forkBlock(t, chain, valid, bobAddress, chain.Subsidy(2)+1000)
+	if err := chain.AcceptBlock(overpaid); err != nil {
+		t.Fatalf("Side branch block rejected: %v", err)
+	}
+	last := forkBlock(t, chain, overpaid, bobAddress, chain.Subsidy(3))
+	if err := chain.AcceptBlock(last); !errors.Is(err, blockchain.ErrBadCoinbase) {
+		t.Fatalf("got %v, want %v", err, blockchain.ErrBadCoinbase)
+	}
+
+	if !bytes.Equal(chain.LastHash(), oldTip) {
+		t.Error("Old tip was not restored")
+	}
+	if _, err := chain.MainChainHash(3); !errors.Is(err, blockchain.ErrBlockNotFound) {
+		t.Errorf("Main chain hash at height 3 after the rollback: got %v, want %v", err, blockchain.ErrBlockNotFound)
+	}
+	if got := utxoCount(t, chain, alice); got != 2 {
+		t.Errorf("Alice has %d outputs, want 2", got)
+	}
+	if got := utxoCount(t, chain, bob); got != 0 {
+		t.Errorf("Bob has %d outputs, want 0", got)
+	}
+
+	next := forkBlock(t, chain, last, bobAddress, chain.Subsidy(4))
+	if err := chain.AcceptBlock(next); !errors.Is(err, blockchain.ErrInvalidParent) {
+		t.Errorf("Child of invalid branch: got %v, want %v", err, blockchain.ErrInvalidParent)
+	}
+}
@@ -0,0 +1,56 @@
+package wallet_test
+
+import (
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+)
+
+// TestSubsidy - это функция, которая проверяет уменьшение награды вдвое и ограничение выпуска.
+func TestSubsidy(t *testing.T) {
+	interval := blockchain.HalvingInterval
+	params := &config.MainNet
+	reward := params.Reward
+
+	cases := []struct {
+		height int
+		want   int
+	}{
+		{0, reward},
+		{interval - 1, reward},
+		{interval, reward / 2},
+		{2 * interval, reward / 4},
+		{64 * interval, 0},
+	}
+	for _, c := range cases {
+		if got := blockchain.Subsidy(params, c.height); got != c.want {
+			t.Errorf("height %d: got %d, want %d", c.height, got, c.want)
+		}
+	}
+
+	total := blockchain.IssuedBefore(params, 100*interval)
+	if total > blockchain.MaxSupply(params) {
+		t.Errorf("issued %d exceeds max supply %d", total, blockchain.MaxSupply(params))
+	}
+	if blockchain.IssuedBefore(params, interval+1) != interval*reward+reward/2 {
+		t.Errorf("unexpected issuance after first halving: %d", blockchain.IssuedBefore(params, interval+1))
+	}
+}
+
+// TestSubsidyNetwork - это функция, которая проверяет, что награда считается по параметрам сети.
+func TestSubsidyNetwork(t *testing.T) {
+	params := config.RegTest
+	params.Reward = 40
+
+	if got := blockchain.Subsidy(&params, 0); got != 40 {
+		t.Errorf("got %d, want 40", got)
+	}
+	coinbase, err := blockchain.CoinbaseTx(&params, string(newWallet(t).VersionedAddress(params.AddressVersion)), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coinbase.Outputs[0].Value != 40 {
+		t.Errorf("Genesis coinbase pays %d, want 40", coinbase.Outputs[0].Value)
+	}
+}
@@ -0,0 +1,132 @@
+package wallet_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+	"github.com/fenix1851/golang-blockchain/storage"
+	wallet "github.com/fenix1851/golang-blockchain/wallet"
+)
+
+// testStore - это функция, которая проверяет чтение, запись, пакеты и обход по префиксу хранилища.
+func testStore(t *testing.T, store storage.Store) {
+	t.Helper()
+	if _, err := store.Get([]byte("a-1")); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Missing key: got %v, want %v", err, storage.ErrNotFound)
+	}
+	for _, key := range []string{"a-2", "b-1", "a-1"} {
+		if err := store.Put([]byte(key), []byte("v"+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Пакет видит свои изменения, а хранилище - только после Write.
+	batch := store.NewBatch()
+	batch.Put([]byte("a-3"), []byte("va-3"))
+	batch.Delete([]byte("a-1"))
+	if value, err := batch.Get([]byte("a-3")); err != nil || string(value) != "va-3" {
+		t.Errorf("Batch does not see its own write: %q, %v", value, err)
+	}
+	if _, err := batch.Get([]byte("a-1")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Batch sees a deleted key: %v", err)
+	}
+	if _, err := store.Get([]byte("a-3")); !errors.Is(err, storage.ErrNotFound) {
+		t.Error("Batch write is visible before Write")
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	err := store.Iterate([]byte("a-"), func(key, value []byte) error {
+		if string(value) != "v"+string(key) {
+			t.Errorf("Key %s has value %s", key, value)
+		}
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "a-2" || keys[1] != "a-3" {
+		t.Errorf("Iterate returned %v, want [a-2 a-3]", keys)
+	}
+
+	count := 0
+	err = store.Iterate([]byte("a-"), func(key, value []byte) error {
+		count++
+		return storage.ErrStopIteration
+	})
+	if err != nil || count != 1 {
+		t.Errorf("Stopped iteration: %d keys, error %v", count, err)
+	}
+}
+
+// TestMemoryStore - это функция, которая проверяет хранилище в памяти.
+func TestMemoryStore(t *testing.T) {
+	testStore(t, storage.NewMemoryStore())
+}
+
+// TestBadgerStore - это функция, которая проверяет, что хранилище badger ведет себя так же, как хранилище в памяти.
+func TestBadgerStore(t *testing.T) {
+	store, err := storage.OpenBadger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testStore(t, store)
+}
+
+// TestBlockChainMemoryStore - это функция, которая создает блокчейн в памяти и проверяет майнинг, баланс и индекс.
+func TestBlockChainMemoryStore(t *testing.T) {
+	store := storage.NewMemoryStore()
+	engine := blockchain.InstantSealEngine{}
+	miner := string(newWallet(t).VersionedAddress(config.RegTest.AddressVersion))
+
+	if _, err := blockchain.ContinueBlockChainWithStore(store, &config.RegTest, engine); !errors.Is(err, blockchain.ErrNoChain) {
+		t.Fatalf("Empty store: got %v, want %v", err, blockchain.ErrNoChain)
+	}
+	chain, err := blockchain.InitBlockChainWithStore(store, &config.RegTest, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := chain.MineBlock(miner, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := blockchain.InitBlockChainWithStore(store, &config.RegTest, engine); !errors.Is(err, blockchain.ErrChainExists) {
+		t.Errorf("Second init: got %v, want %v", err, blockchain.ErrChainExists)
+	}
+
+	reopened, err := blockchain.ContinueBlockChainWithStore(store, &config.RegTest, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height, err := reopened.GetBestHeight(); err != nil || height != 3 {
+		t.Fatalf("Reopened chain height %d, %v, want 3", height, err)
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: reopened}
+	pubKeyHash, err := wallet.PubKeyHashFromAddress(miner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, immature, err := UTXOSet.Balance(pubKeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Награда генезис-блока заблокирована на ключ, которого нет ни у кого, майнеру принадлежат только три блока.
+	if immature != 3*config.RegTest.Reward {
+		t.Errorf("Immature balance %d, want %d", immature, 3*config.RegTest.Reward)
+	}
+
+	if err := UTXOSet.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := UTXOSet.CountTransactions(); err != nil || count != 4 {
+		t.Errorf("Reindexed UTXO set has %d transactions, %v, want 4", count, err)
+	}
+}
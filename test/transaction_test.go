@@ -0,0 +1,192 @@
+package wallet_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+	wallet "github.com/fenix1851/golang-blockchain/wallet"
+)
+
+// newWallet - это функция, которая создает кошелек и останавливает тест при ошибке.
+func newWallet(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// coinbaseTx - это функция, которая создает coinbase-транзакцию и останавливает тест при ошибке.
+func coinbaseTx(t *testing.T, to, data string) *blockchain.Transaction {
+	t.Helper()
+	tx, err := blockchain.CoinbaseTx(&config.MainNet, to, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// spendTx - это функция, которая создает транзакцию, тратящую первый выход prev.
+func spendTx(t *testing.T, from *wallet.Wallet, to string, prev *blockchain.Transaction) *blockchain.Transaction {
+	t.Helper()
+	in := blockchain.TXInput{ID: prev.ID, Out: 0, PubKey: from.PublicKey}
+	out, err := blockchain.NewTXOutput(prev.Outputs[0].Value, to, config.MainNet.AddressVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := &blockchain.Transaction{Inputes: []blockchain.TXInput{in}, Outputs: []blockchain.TXOutput{*out}}
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// TestTransactionSignVerify - это функция, которая тестирует подпись и проверку транзакции.
+func TestTransactionSignVerify(t *testing.T) {
+	alice := newWallet(t)
+	bob := newWallet(t)
+
+	coinbase := coinbaseTx(t, string(alice.Address()), "")
+	prevTXs := map[string]blockchain.Transaction{hex.EncodeToString(coinbase.ID): *coinbase}
+
+	tx := spendTx(t, alice, string(bob.Address()), coinbase)
+	if tx.Verify(prevTXs) {
+		t.Error("Unsigned transaction passed verification")
+	}
+
+	if err := tx.Sign(alice.PrivateKey, prevTXs); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Verify(prevTXs) {
+		t.Error("Signed transaction failed verification")
+	}
+
+	tx.Outputs[0].Value++
+	if tx.Verify(prevTXs) {
+		t.Error("Tampered transaction passed verification")
+	}
+}
+
+// TestTransactionForeignKey - это функция, которая проверяет, что нельзя потратить чужой выход.
+func TestTransactionForeignKey(t *testing.T) {
+	alice := newWallet(t)
+	mallory := newWallet(t)
+
+	coinbase := coinbaseTx(t, string(alice.Address()), "")
+	prevTXs := map[string]blockchain.Transaction{hex.EncodeToString(coinbase.ID): *coinbase}
+
+	tx := spendTx(t, mallory, string(mallory.Address()), coinbase)
+	if err := tx.Sign(mallory.PrivateKey, prevTXs); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Verify(prevTXs) {
+		t.Error("Transaction signed with a foreign key passed verification")
+	}
+}
+
+// TestTransactionErrors - это функция, которая проверяет, что неверный адрес и неизвестный вход
+// возвращаются как ошибки, а не останавливают программу.
+func TestTransactionErrors(t *testing.T) {
+	if _, err := blockchain.CoinbaseTx(&config.MainNet, "0OIl", ""); !errors.Is(err, blockchain.ErrBadAddress) {
+		t.Errorf("Bad coinbase address: got %v, want %v", err, blockchain.ErrBadAddress)
+	}
+	testnetAddress := string(newWallet(t).VersionedAddress(config.TestNet.AddressVersion))
+	if _, err := blockchain.NewTXOutput(10, testnetAddress, config.MainNet.AddressVersion); !errors.Is(err, blockchain.ErrBadAddress) {
+		t.Errorf("Address of another network: got %v, want %v", err, blockchain.ErrBadAddress)
+	}
+
+	alice := newWallet(t)
+	coinbase := coinbaseTx(t, string(alice.Address()), "")
+	tx := spendTx(t, alice, string(alice.Address()), coinbase)
+	if err := tx.Sign(alice.PrivateKey, map[string]blockchain.Transaction{}); !errors.Is(err, blockchain.ErrMissingInput) {
+		t.Errorf("Unknown input: got %v, want %v", err, blockchain.ErrMissingInput)
+	}
+}
+
+// TestTransactionHashStable - это функция, которая проверяет, что ID транзакции зависит только от ее полей:
+// узлы вычисляют его в разных процессах, и он не должен меняться от порядка кодирования типов gob.
+func TestTransactionHashStable(t *testing.T) {
+	tx := blockchain.Transaction{
+		Inputes: []blockchain.TXInput{{ID: []byte{1, 2}, Out: 3, Signature: []byte{4}, PubKey: []byte{5, 6}}},
+		Outputs: []blockchain.TXOutput{{Value: 7, PubKeyHash: []byte{8, 9}}},
+	}
+	got := hex.EncodeToString(tx.Hash())
+	const want = "8defd0f2f33a42bbf03c7f848c77df4bf5ac0abe4f8e1c241a81ecd2662eb91e"
+	if got != want {
+		t.Errorf("Transaction hash %s, want %s", got, want)
+	}
+	tx.ID = []byte{10}
+	if hex.EncodeToString(tx.Hash()) != got {
+		t.Error("Transaction ID changes its hash")
+	}
+}
+
+// TestSignatureLength - это функция, которая проверяет, что подписи и публичные ключи имеют фиксированную длину
+// и проверяются всегда, даже когда r, s, X или Y короче 32 байт.
+func TestSignatureLength(t *testing.T) {
+	alice := newWallet(t)
+	coinbase := coinbaseTx(t, string(alice.Address()), "")
+	prevTXs := map[string]blockchain.Transaction{hex.EncodeToString(coinbase.ID): *coinbase}
+
+	// Короткие r или s получаются примерно в одной подписи из 128, поэтому подписей нужно много.
+	for i := 0; i < 1000; i++ {
+		tx := spendTx(t, alice, string(alice.Address()), coinbase)
+		tx.Outputs[0].Value = i + 1
+		if err := tx.Sign(alice.PrivateKey, prevTXs); err != nil {
+			t.Fatal(err)
+		}
+		if len(tx.Inputes[0].Signature) != 64 || !tx.Verify(prevTXs) {
+			t.Fatalf("Signature %x failed verification", tx.Inputes[0].Signature)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		if _, pub, err := wallet.NewKeyPair(); err != nil || len(pub) != wallet.PublicKeyLen {
+			t.Fatalf("Public key %x, %v", pub, err)
+		}
+	}
+}
+
+// TestFeePolicy - это функция, которая проверяет, что комиссия транзакции равна Fixed
+// и покрывает PerByte за каждый байт транзакции.
+func TestFeePolicy(t *testing.T) {
+	// Комиссия за байт больше награды RegTest, поэтому награда увеличена, а сверка генезис-блока отключена.
+	params := config.RegTest
+	params.Reward = 100000
+	params.GenesisHash = ""
+	owner := newWallet(t)
+	chain := newMinerChain(t, &params, owner, params.CoinbaseMaturity)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	to := string(newWallet(t).VersionedAddress(params.AddressVersion))
+
+	fee := func(tx *blockchain.Transaction) int {
+		fees, err := chain.ValidateTransactions([]*blockchain.Transaction{tx})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fees
+	}
+
+	fixed, err := blockchain.NewTransaction(owner, to, 10, blockchain.FeePolicy{Fixed: 3}, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fee(fixed); got != 3 {
+		t.Errorf("Fixed fee %d, want 3", got)
+	}
+
+	policy := blockchain.FeePolicy{Fixed: 1, PerByte: 2}
+	sized, err := blockchain.NewTransaction(owner, to, 10, policy, &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, min := fee(sized), policy.Fixed+policy.PerByte*len(sized.Serialize()); got < min {
+		t.Errorf("Fee %d does not cover %d bytes, want at least %d", got, len(sized.Serialize()), min)
+	}
+
+	if _, err := blockchain.NewTransaction(owner, to, 10, blockchain.FeePolicy{Fixed: params.Reward}, &UTXOSet); !errors.Is(err, blockchain.ErrInsufficientFunds) {
+		t.Errorf("Fee above balance: got %v, want %v", err, blockchain.ErrInsufficientFunds)
+	}
+}
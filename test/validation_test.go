@@ -0,0 +1,225 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/fenix1851/golang-blockchain/blockchain"
+	"github.com/fenix1851/golang-blockchain/config"
+)
+
+// newTestBlock - это функция, которая собирает блок без майнинга, только для проверки правил.
+func newTestBlock(txs ...*blockchain.Transaction) *blockchain.Block {
+	block := &blockchain.Block{Transactions: txs}
+	block.Version = blockchain.BlockVersion
+	block.MerkleRoot = block.HashTransactions()
+	return block
+}
+
+// TestCheckBlockSanity - это функция, которая проверяет правила блока, не зависящие от состояния блокчейна.
+func TestCheckBlockSanity(t *testing.T) {
+	miner := string(newWallet(t).Address())
+	coinbase := coinbaseTx(t, miner, "")
+	other := coinbaseTx(t, miner, "other")
+
+	if err := blockchain.CheckBlockSanity(newTestBlock(coinbase)); err != nil {
+		t.Fatalf("Valid block rejected: %v", err)
+	}
+
+	badRoot := newTestBlock(coinbase)
+	badRoot.MerkleRoot = []byte("bad")
+
+	wrongHeight := newTestBlock(coinbase)
+	wrongHeight.Height = 1
+
+	tooHard := newTestBlock(coinbase)
+	tooHard.Bits = 300
+
+	negativeBits := newTestBlock(coinbase)
+	negativeBits.Bits = -1
+
+	cases := []struct {
+		name  string
+		block *blockchain.Block
+		want  error
+	}{
+		{"empty", newTestBlock(), blockchain.ErrNoTransactions},
+		{"duplicate", newTestBlock(coinbase, coinbase), blockchain.ErrDuplicateTx},
+		{"second coinbase", newTestBlock(coinbase, other), blockchain.ErrBadCoinbase},
+		{"merkle root", badRoot, blockchain.ErrBadMerkleRoot},
+		{"coinbase height", wrongHeight, blockchain.ErrBadCoinbase},
+		{"bits above max", tooHard, blockchain.ErrBadBits},
+		{"negative bits", negativeBits, blockchain.ErrBadBits},
+	}
+
+	for _, c := range cases {
+		if err := blockchain.CheckBlockSanity(c.block); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+// TestCoinbaseUnique - это функция, которая проверяет, что coinbase разных блоков имеют разные ID.
+func TestCoinbaseUnique(t *testing.T) {
+	miner := string(newWallet(t).Address())
+
+	first, err := blockchain.NewCoinbaseTx(&config.MainNet, miner, "", config.MainNet.Reward, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := blockchain.NewCoinbaseTx(&config.MainNet, miner, "", config.MainNet.Reward, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rolled, err := blockchain.NewCoinbaseTx(&config.MainNet, miner, "", config.MainNet.Reward, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(first.ID) == string(second.ID) || string(first.ID) == string(rolled.ID) {
+		t.Error("Coinbase IDs collide")
+	}
+	if height, ok := second.CoinbaseHeight(); !ok || height != 2 {
+		t.Errorf("got height %d, want 2", height)
+	}
+}
+
+// TestCheckTransactionSanity - это функция, которая проверяет границы сумм выходов транзакции.
+func TestCheckTransactionSanity(t *testing.T) {
+	owner := newWallet(t)
+	to := string(newWallet(t).Address())
+	prev := coinbaseTx(t, string(owner.Address()), "")
+
+	withValues := func(values ...int) *blockchain.Transaction {
+		tx := spendTx(t, owner, to, prev)
+		tx.Outputs = nil
+		for _, value := range values {
+			tx.Outputs = append(tx.Outputs, blockchain.TXOutput{Value: value, PubKeyHash: prev.Outputs[0].PubKeyHash})
+		}
+		tx.ID = tx.Hash()
+		return tx
+	}
+
+	if err := blockchain.CheckTransactionSanity(withValues(blockchain.MaxMoney)); err != nil {
+		t.Errorf("Transaction paying MaxMoney rejected: %v", err)
+	}
+	cases := []struct {
+		name string
+		tx   *blockchain.Transaction
+	}{
+		{"negative", withValues(-1000)},
+		{"above max", withValues(blockchain.MaxMoney + 1)},
+		{"sum above max", withValues(blockchain.MaxMoney, 1)},
+		{"overflow", withValues(math.MaxInt64, math.MaxInt64)},
+	}
+	for _, c := range cases {
+		if err := blockchain.CheckTransactionSanity(c.tx); !errors.Is(err, blockchain.ErrBadValue) {
+			t.Errorf("%s: got %v, want %v", c.name, err, blockchain.ErrBadValue)
+		}
+	}
+}
+
+// TestValidateOverflow - это функция, которая проверяет, что транзакция, сумма выходов которой переполняет int,
+// не проходит ни проверку транзакций, ни мемпул.
+func TestValidateOverflow(t *testing.T) {
+	owner := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	tx := newPoolTx(t, &UTXOSet, owner, 10, 1)
+	tx.Outputs = []blockchain.TXOutput{
+		{Value: math.MaxInt64, PubKeyHash: tx.Outputs[0].PubKeyHash},
+		{Value: math.MaxInt64, PubKeyHash: tx.Outputs[0].PubKeyHash},
+	}
+	if err := chain.SignTransaction(tx, owner.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := chain.ValidateTransactions([]*blockchain.Transaction{tx}); !errors.Is(err, blockchain.ErrBadValue) {
+		t.Errorf("ValidateTransactions: got %v, want %v", err, blockchain.ErrBadValue)
+	}
+	if err := newTestMempool(t, chain).Add(tx); !errors.Is(err, blockchain.ErrBadValue) {
+		t.Errorf("Mempool: got %v, want %v", err, blockchain.ErrBadValue)
+	}
+}
+
+// TestCoinbaseFees - это функция, которая проверяет, что майнер получает комиссии транзакций блока,
+// а блок, coinbase которого платит больше награды и комиссий, отклоняется.
+func TestCoinbaseFees(t *testing.T) {
+	owner := newWallet(t)
+	chain := newMinerChain(t, &config.RegTest, owner, config.RegTest.CoinbaseMaturity)
+	miner := string(owner.VersionedAddress(config.RegTest.AddressVersion))
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	tx := newPoolTx(t, &UTXOSet, owner, 10, 7)
+
+	if fees, err := chain.ValidateTransactions([]*blockchain.Transaction{tx}); err != nil || fees != 7 {
+		t.Fatalf("got fees %d, %v, want 7", fees, err)
+	}
+
+	tip := mainBlock(t, chain, config.RegTest.CoinbaseMaturity)
+	overpay := forkBlock(t, chain, tip, miner, chain.Subsidy(tip.Height+1)+7+1)
+	overpay.Transactions = append(overpay.Transactions, tx)
+	overpay.MerkleRoot = overpay.HashTransactions()
+	if err := chain.Engine.Seal(context.Background(), chain, overpay); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AcceptBlock(overpay); !errors.Is(err, blockchain.ErrBadCoinbase) {
+		t.Errorf("Overpaying coinbase: got %v, want %v", err, blockchain.ErrBadCoinbase)
+	}
+
+	block, err := chain.MineBlock(miner, []*blockchain.Transaction{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paid, want := block.Transactions[0].Outputs[0].Value, chain.Subsidy(block.Height)+7; paid != want {
+		t.Errorf("Coinbase pays %d, want %d", paid, want)
+	}
+}
+
+// TestValidateMaturity - это функция, которая проверяет, что выходы coinbase нельзя тратить,
+// пока не прошло CoinbaseMaturity блоков, ни из UTXOSet, ни из того же списка транзакций.
+func TestValidateMaturity(t *testing.T) {
+	owner := newWallet(t)
+	maturity := config.RegTest.CoinbaseMaturity
+	chain := newMinerChain(t, &config.RegTest, owner, maturity-1)
+	to := string(newWallet(t).VersionedAddress(config.RegTest.AddressVersion))
+
+	// signedSpend - это функция, которая тратит первый выход prev и подписывает транзакцию по prev.
+	signedSpend := func(prev *blockchain.Transaction) *blockchain.Transaction {
+		tx := spendTx(t, owner, string(owner.Address()), prev)
+		out, err := blockchain.NewTXOutput(prev.Outputs[0].Value, to, config.RegTest.AddressVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Outputs = []blockchain.TXOutput{*out}
+		if err := tx.SignOutputs(owner.PrivateKey, []blockchain.TXOutput{prev.Outputs[0]}); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	// Выход блока 1 в следующем блоке, высоты maturity, созрел бы только через блок.
+	immature := signedSpend(mainBlock(t, chain, 1).Transactions[0])
+	if _, err := chain.ValidateTransactions([]*blockchain.Transaction{immature}); !errors.Is(err, blockchain.ErrImmatureSpend) {
+		t.Errorf("Immature output: got %v, want %v", err, blockchain.ErrImmatureSpend)
+	}
+
+	miner := string(owner.VersionedAddress(config.RegTest.AddressVersion))
+	coinbase, err := blockchain.NewCoinbaseTx(chain.Params, miner, "", chain.Subsidy(maturity), maturity, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameList := []*blockchain.Transaction{coinbase, signedSpend(coinbase)}
+	if _, err := chain.ValidateTransactions(sameList); !errors.Is(err, blockchain.ErrImmatureSpend) {
+		t.Errorf("Coinbase of the same block: got %v, want %v", err, blockchain.ErrImmatureSpend)
+	}
+
+	if _, err := chain.MineBlock(miner, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.ValidateTransactions([]*blockchain.Transaction{immature}); err != nil {
+		t.Errorf("Mature output rejected: %v", err)
+	}
+}
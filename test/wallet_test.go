@@ -1,14 +1,22 @@
 package wallet_test
 
 import (
+	"bytes"
+	"errors"
+	"path/filepath"
 	"testing"
 
+	"github.com/fenix1851/golang-blockchain/config"
 	wallet "github.com/fenix1851/golang-blockchain/wallet"
+	"github.com/mr-tron/base58"
 )
 
 // TestWallet - это функция, которая тестирует функцию Wallet.
 func TestNewWallet(t *testing.T) {
-	wallet := wallet.NewWallet()
+	wallet, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
 	address := wallet.Address()
 	t.Logf("Address: %s", address)
 }
@@ -16,7 +24,10 @@ func TestNewWallet(t *testing.T) {
 // TestNewKeyPair - это функция, которая тестирует функцию NewKeyPair.
 
 func TestNewKeyPair(t *testing.T) {
-	priv, pub := wallet.NewKeyPair()
+	priv, pub, err := wallet.NewKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
 	if priv.X == nil {
 		t.Error("Private key is nil")
 		return
@@ -30,7 +41,7 @@ func TestNewKeyPair(t *testing.T) {
 }
 
 func TestCreateWallets(t *testing.T) {
-	wallets, err := wallet.CreateWallets()
+	wallets, err := wallet.CreateWallets(config.New(t.TempDir(), &config.MainNet))
 	if err != nil {
 		t.Error(err)
 	}
@@ -38,17 +49,20 @@ func TestCreateWallets(t *testing.T) {
 }
 
 func TestWalletsAddWallet(t *testing.T) {
-	wallets, err := wallet.CreateWallets()
+	wallets, err := wallet.CreateWallets(config.New(t.TempDir(), &config.MainNet))
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
 	}
-	address := wallets.AddWallet()
+	address, err := wallets.AddWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
 	t.Logf("Address: %s", address)
 }
 
 func TestWalletsSaveFile(t *testing.T) {
-	wallets, err := wallet.CreateWallets()
+	wallets, err := wallet.CreateWallets(config.New(t.TempDir(), &config.MainNet))
 	if err != nil {
 		t.Error(err)
 	}
@@ -59,10 +73,99 @@ func TestWalletsSaveFile(t *testing.T) {
 }
 
 func TestWalletsGetAllAddresses(t *testing.T) {
-	wallets, err := wallet.CreateWallets()
+	wallets, err := wallet.CreateWallets(config.New(t.TempDir(), &config.MainNet))
 	if err != nil {
 		t.Error(err)
 	}
 	addresses := wallets.GetAllAddresses()
 	t.Logf("Addresses: %v", addresses)
 }
+
+// TestValidateAddress - это функция, которая проверяет разбор адреса и его контрольной суммы.
+func TestValidateAddress(t *testing.T) {
+	w := newWallet(t)
+	address := string(w.Address())
+
+	pubKeyHash, err := wallet.PubKeyHashFromAddress(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pubKeyHash) != string(wallet.PublicKeyHash(w.PublicKey)) {
+		t.Error("Public key hash does not match the wallet")
+	}
+
+	// Меняем последний символ адреса, чтобы испортить контрольную сумму.
+	tampered := []byte(address)
+	if tampered[len(tampered)-1] == '2' {
+		tampered[len(tampered)-1] = '3'
+	} else {
+		tampered[len(tampered)-1] = '2'
+	}
+	if wallet.ValidateAddress(string(tampered), config.MainNet.AddressVersion) {
+		t.Error("Tampered address passed validation")
+	}
+	if wallet.ValidateAddress("0OIl", config.MainNet.AddressVersion) {
+		t.Error("Non-base58 address passed validation")
+	}
+}
+
+// TestWalletsDataDir - это функция, которая проверяет, что кошельки сохраняются в папку данных из настроек
+// и загружаются из нее обратно, даже если папки еще нет.
+func TestWalletsDataDir(t *testing.T) {
+	cfg := config.New(filepath.Join(t.TempDir(), "node"), &config.MainNet)
+	wallets, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := wallets.AddWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := wallet.CreateWallets(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.GetWallet(address) == nil {
+		t.Errorf("Wallet %s is not loaded from %s", address, cfg.WalletFile)
+	}
+}
+
+// TestValidateAddressNetwork - это функция, которая проверяет, что адрес одной сети не проходит проверку в другой.
+func TestValidateAddressNetwork(t *testing.T) {
+	w := newWallet(t)
+	networks := []*config.ChainParams{&config.MainNet, &config.TestNet, &config.RegTest}
+
+	for _, own := range networks {
+		address := string(w.VersionedAddress(own.AddressVersion))
+		for _, other := range networks {
+			valid := wallet.ValidateAddress(address, other.AddressVersion)
+			if valid != (own == other) {
+				t.Errorf("%s address on %s: valid = %v", own.Name, other.Name, valid)
+			}
+		}
+		if _, err := wallet.PubKeyHashForNetwork(address, config.MainNet.AddressVersion); own != &config.MainNet && !errors.Is(err, wallet.ErrWrongNetwork) {
+			t.Errorf("%s address on mainnet: got %v, want %v", own.Name, err, wallet.ErrWrongNetwork)
+		}
+	}
+}
+
+// TestDecodeAddressLength - это функция, которая проверяет, что адрес с правильной контрольной суммой,
+// но хэшем не той длины, не разбирается.
+func TestDecodeAddressLength(t *testing.T) {
+	for _, n := range []int{0, 19, 21, 32} {
+		payload := append([]byte{config.MainNet.AddressVersion}, bytes.Repeat([]byte{1}, n)...)
+		address := base58.Encode(append(payload, wallet.Checksum(payload)...))
+		if _, _, err := wallet.DecodeAddress(address); !errors.Is(err, wallet.ErrBadAddress) {
+			t.Errorf("%d-byte hash: got %v, want %v", n, err, wallet.ErrBadAddress)
+		}
+	}
+
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, hash, err := wallet.DecodeAddress(string(w.Address())); err != nil || len(hash) != wallet.PubKeyHashLen {
+		t.Errorf("Wallet address: %d-byte hash, %v", len(hash), err)
+	}
+}
@@ -1,8 +1,6 @@
 package wallet
 
 import (
-	"log"
-
 	"github.com/mr-tron/base58"
 )
 
@@ -13,15 +11,6 @@ func Base58Encode(input []byte) []byte {
 }
 
 // Base58Decode - это функция, которая декодирует из base58.
-func Base58Decode(input []byte) []byte {
-	decode, err := base58.Decode(string(input))
-	Handle(err)
-	return decode
-}
-
-// Handle - это функция, которая обрабатывает ошибки.
-func Handle(err error) {
-	if err != nil {
-		log.Panic(err)
-	}
+func Base58Decode(input []byte) ([]byte, error) {
+	return base58.Decode(string(input))
 }
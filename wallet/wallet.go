@@ -1,18 +1,38 @@
 package wallet
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"errors"
+	"fmt"
 
+	"github.com/mr-tron/base58"
 	"golang.org/x/crypto/ripemd160"
 )
 
 const (
 	addressChecksumLen = 4
-	version            = byte(0x00)
+	// version - это байт версии адресов основной сети.
+	version = byte(0x00)
+	// keyPartLen - это длина координаты X или Y публичного ключа P-256 в байтах.
+	keyPartLen = 32
+	// PublicKeyLen - это длина публичного ключа: X и Y, каждая дополнена нулями до keyPartLen байт.
+	// Без дополнения ключ с короткой координатой нельзя было бы разделить на X и Y.
+	PublicKeyLen = 2 * keyPartLen
+	// PubKeyHashLen - это длина хэша публичного ключа: длина RIPEMD-160.
+	PubKeyHashLen = ripemd160.Size
+)
+
+// Ошибки разбора адресов.
+var (
+	// ErrBadAddress - это ошибка адреса, который не разбирается: не base58, неверная контрольная сумма или длина.
+	ErrBadAddress = errors.New("malformed address")
+	// ErrWrongNetwork - это ошибка, когда адрес принадлежит другой сети.
+	ErrWrongNetwork = errors.New("address belongs to another network")
 )
 
 // Wallet - это структура данных, которая хранит в себе
@@ -28,34 +48,39 @@ type WalletWrapper struct {
 	PublicKey  []byte
 }
 
-func NewWalletWrapper(w *Wallet) *WalletWrapper {
+func NewWalletWrapper(w *Wallet) (*WalletWrapper, error) {
 	privateKeyBytes, err := x509.MarshalECPrivateKey(&w.PrivateKey)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	return &WalletWrapper{
 		PrivateKey: privateKeyBytes,
 		PublicKey:  w.PublicKey,
-	}
+	}, nil
 }
 
-func (ww *WalletWrapper) ToWallet() *Wallet {
+func (ww *WalletWrapper) ToWallet() (*Wallet, error) {
 	privateKey, err := x509.ParseECPrivateKey(ww.PrivateKey)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	return &Wallet{
 		PrivateKey: *privateKey,
 		PublicKey:  ww.PublicKey,
-	}
+	}, nil
 }
 
-// Address - это функция, которая возвращает адрес кошелька.
+// Address - это функция, которая возвращает адрес кошелька в основной сети.
 func (w Wallet) Address() []byte {
+	return w.VersionedAddress(version)
+}
+
+// VersionedAddress - это функция, которая возвращает адрес кошелька с байтом версии сети addressVersion.
+func (w Wallet) VersionedAddress(addressVersion byte) []byte {
 	// pubKeyHash - это хэш публичного ключа.
-	pubKeyHash := publicKeyHash(w.PublicKey)
+	pubKeyHash := PublicKeyHash(w.PublicKey)
 	// versionedPayload - это версия публичного ключа.
-	versionedPayload := append([]byte{version}, pubKeyHash...)
+	versionedPayload := append([]byte{addressVersion}, pubKeyHash...)
 	// checksum - это контрольная сумма.
 	checksum := Checksum(versionedPayload)
 	// fullPayload - это полная версия публичного ключа.
@@ -73,28 +98,31 @@ func (w Wallet) Address() []byte {
 }
 
 // NewKeyPair - это функция, которая создает новую пару ключей.
-func NewKeyPair() (ecdsa.PrivateKey, []byte) {
+func NewKeyPair() (ecdsa.PrivateKey, []byte, error) {
 	// curve - это кривая, которая будет использоваться для создания ключей.
 	curve := elliptic.P256()
 	// priv - это приватный ключ.
 	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
-	// Если произошла ошибка, то мы выводим ее в консоль.
-	Handle(err)
-	// pub - это публичный ключ.
-	pub := append(priv.PublicKey.X.Bytes(), priv.PublicKey.Y.Bytes()...)
+	// Если произошла ошибка, то мы возвращаем ее.
+	if err != nil {
+		return ecdsa.PrivateKey{}, nil, err
+	}
+	// pub - это публичный ключ: X и Y фиксированной длины.
+	pub := make([]byte, PublicKeyLen)
+	priv.PublicKey.X.FillBytes(pub[:keyPartLen])
+	priv.PublicKey.Y.FillBytes(pub[keyPartLen:])
 	// Возвращаем приватный ключ и публичный ключ.
-	return *priv, pub
+	return *priv, pub, nil
 }
 
-// publicKeyHash - это функция, которая хеширует публичный ключ.
-func publicKeyHash(publicKey []byte) []byte {
+// PublicKeyHash - это функция, которая хеширует публичный ключ.
+func PublicKeyHash(publicKey []byte) []byte {
 	// hash - это хэш публичного ключа.
 	hash := sha256.Sum256(publicKey)
 
 	hasher := ripemd160.New()
-	_, err := hasher.Write(hash[:])
-	// Если произошла ошибка, то мы выводим ее в консоль.
-	Handle(err)
+	// Write у хэш-функции никогда не возвращает ошибку.
+	hasher.Write(hash[:])
 	// Возвращаем хэш публичного ключа.
 	return hasher.Sum(nil)
 }
@@ -108,10 +136,60 @@ func Checksum(payload []byte) []byte {
 	return secondHash[:addressChecksumLen]
 }
 
+// DecodeAddress - это функция, которая достает из адреса байт версии сети и хэш публичного ключа.
+// Она декодирует адрес из base58 и проверяет его контрольную сумму и длину хэша.
+// Если адрес не разбирается, возвращается ErrBadAddress.
+func DecodeAddress(address string) (byte, []byte, error) {
+	fullPayload, err := base58.Decode(address)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrBadAddress, err)
+	}
+	// Адрес - это байт версии, хэш публичного ключа и контрольная сумма.
+	if len(fullPayload) != 1+PubKeyHashLen+addressChecksumLen {
+		return 0, nil, fmt.Errorf("%w: %d bytes", ErrBadAddress, len(fullPayload))
+	}
+	// versionedPayload - это версия и хэш публичного ключа без контрольной суммы.
+	versionedPayload := fullPayload[:len(fullPayload)-addressChecksumLen]
+	actualChecksum := fullPayload[len(fullPayload)-addressChecksumLen:]
+	if !bytes.Equal(actualChecksum, Checksum(versionedPayload)) {
+		return 0, nil, fmt.Errorf("%w: invalid checksum", ErrBadAddress)
+	}
+	return versionedPayload[0], versionedPayload[1:], nil
+}
+
+// PubKeyHashFromAddress - это функция, которая достает хэш публичного ключа из адреса любой сети.
+func PubKeyHashFromAddress(address string) ([]byte, error) {
+	_, pubKeyHash, err := DecodeAddress(address)
+	return pubKeyHash, err
+}
+
+// PubKeyHashForNetwork - это функция, которая достает хэш публичного ключа из адреса
+// и проверяет, что адрес принадлежит сети с байтом версии addressVersion.
+func PubKeyHashForNetwork(address string, addressVersion byte) ([]byte, error) {
+	actual, pubKeyHash, err := DecodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if actual != addressVersion {
+		return nil, ErrWrongNetwork
+	}
+	return pubKeyHash, nil
+}
+
+// ValidateAddress - это функция, которая проверяет, является ли строка корректным адресом сети
+// с байтом версии addressVersion. Адреса других сетей не проходят проверку.
+func ValidateAddress(address string, addressVersion byte) bool {
+	_, err := PubKeyHashForNetwork(address, addressVersion)
+	return err == nil
+}
+
 // NewWallet - это функция, которая создает новый кошелек.
-func NewWallet() *Wallet {
+func NewWallet() (*Wallet, error) {
 	// Создаем новый кошелек.
-	private, public := NewKeyPair()
+	private, public, err := NewKeyPair()
+	if err != nil {
+		return nil, err
+	}
 	// Возвращаем кошелек.
-	return &Wallet{private, public}
+	return &Wallet{private, public}, nil
 }
@@ -4,14 +4,20 @@ import (
 	"bytes"
 	"crypto/elliptic"
 	"encoding/gob"
-	"fmt"
 	"os"
-)
+	"path/filepath"
 
-const walletFile = "./tmp/wallets.data"
+	"github.com/fenix1851/golang-blockchain/config"
+)
 
+// Wallets - это кошельки из файла кошельков узла.
+// Адреса кошельков записываются с байтом версии сети, в которой работает узел.
 type Wallets struct {
 	Wallets map[string]*Wallet
+	// file - это путь к файлу кошельков.
+	file string
+	// version - это байт версии адресов сети.
+	version byte
 }
 
 func init() {
@@ -19,11 +25,11 @@ func init() {
 }
 
 func (ws *Wallets) LoadFile() error {
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+	if _, err := os.Stat(ws.file); os.IsNotExist(err) {
 		return err
 	}
 
-	fileContent, err := os.ReadFile(walletFile)
+	fileContent, err := os.ReadFile(ws.file)
 	if err != nil {
 		return err
 	}
@@ -37,7 +43,11 @@ func (ws *Wallets) LoadFile() error {
 
 	ws.Wallets = make(map[string]*Wallet)
 	for address, wrapper := range walletWrappers {
-		ws.Wallets[address] = wrapper.ToWallet()
+		w, err := wrapper.ToWallet()
+		if err != nil {
+			return err
+		}
+		ws.Wallets[address] = w
 	}
 
 	return nil
@@ -55,16 +65,14 @@ func (ws *Wallets) GetWallet(address string) *Wallet {
 	return ws.Wallets[address]
 }
 
-func CreateWallets() (*Wallets, error) {
-	wallets := Wallets{}
+// CreateWallets - это функция, которая загружает кошельки из файла cfg.WalletFile или создает пустой файл.
+func CreateWallets(cfg *config.Config) (*Wallets, error) {
+	wallets := Wallets{file: cfg.WalletFile, version: cfg.Params.AddressVersion}
 	wallets.Wallets = make(map[string]*Wallet)
 	err := wallets.LoadFile()
 	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
-	if err != nil {
-		fmt.Println("No wallet file found. Creating new wallet file...")
-	}
 	if os.IsNotExist(err) {
 		err = wallets.SaveFile()
 		if err != nil {
@@ -75,29 +83,39 @@ func CreateWallets() (*Wallets, error) {
 	return &wallets, nil
 }
 
-func (ws *Wallets) AddWallet() string {
-	wallet := NewWallet()
-	address := string(wallet.Address())
-	ws.Wallets[address] = wallet
-	err := ws.SaveFile()
+// AddWallet - это функция, которая создает новый кошелек, сохраняет файл кошельков и возвращает адрес кошелька.
+func (ws *Wallets) AddWallet() (string, error) {
+	wallet, err := NewWallet()
 	if err != nil {
-		fmt.Println(err)
+		return "", err
+	}
+	address := string(wallet.VersionedAddress(ws.version))
+	ws.Wallets[address] = wallet
+	if err := ws.SaveFile(); err != nil {
+		return "", err
 	}
 
-	return address
+	return address, nil
 }
 
 func (ws *Wallets) SaveFile() error {
 	var content bytes.Buffer
 	walletWrappers := make(map[string]*WalletWrapper)
 	for address, wallet := range ws.Wallets {
-		walletWrappers[address] = NewWalletWrapper(wallet)
+		wrapper, err := NewWalletWrapper(wallet)
+		if err != nil {
+			return err
+		}
+		walletWrappers[address] = wrapper
 	}
 	encoder := gob.NewEncoder(&content)
 	err := encoder.Encode(walletWrappers)
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(walletFile, content.Bytes(), 0644)
+	if err := os.MkdirAll(filepath.Dir(ws.file), 0755); err != nil {
+		return err
+	}
+	err = os.WriteFile(ws.file, content.Bytes(), 0644)
 	return err
 }